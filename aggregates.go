@@ -0,0 +1,237 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Accumulator computes an aggregate value incrementally, so that a group of
+// rows never has to be kept in memory as a whole.
+type Accumulator interface {
+	// Step adds one row to the accumulator. args are the values of the
+	// aggregate's arguments for that row, empty for a star argument.
+	Step(args []Value) error
+
+	// Merge adds the state of another accumulator of the same kind.
+	Merge(other Accumulator) error
+
+	// Final returns the aggregate value.
+	Final() (Value, error)
+}
+
+// builtinAggregates maps aggregate names to their accumulator constructors.
+var builtinAggregates = map[string]func() Accumulator{
+	"count": func() Accumulator { return &countAccumulator{} },
+	"min":   func() Accumulator { return &minAccumulator{} },
+}
+
+func isAggregate(name string) bool {
+	_, ok := builtinAggregates[strings.ToLower(name)]
+	return ok
+}
+
+// isAggregate tells whether the name refers to an aggregate function.
+// Registered scalar functions take precedence over built-in aggregates.
+func (e Engine) isAggregate(name string) bool {
+	n := strings.ToLower(name)
+	if _, ok := e.functions[n]; ok {
+		return false
+	}
+	if _, ok := e.aggregates[n]; ok {
+		return true
+	}
+	return isAggregate(n)
+}
+
+func (e Engine) newAccumulator(a *aggregate) (Accumulator, error) {
+	n := strings.ToLower(a.Name)
+	if f, ok := e.aggregates[n]; ok {
+		return f(), nil
+	}
+	if f, ok := builtinAggregates[n]; ok {
+		return f(), nil
+	}
+	return nil, fmt.Errorf("unknown aggregate: %s", a.Name)
+}
+
+// count(*) counts rows, count(x) counts rows where x is not null.
+type countAccumulator struct {
+	n int
+}
+
+func (a *countAccumulator) Step(args []Value) error {
+	switch len(args) {
+	case 0:
+		a.n++
+	case 1:
+		if args[0].Data != nil {
+			a.n++
+		}
+	default:
+		return fmt.Errorf("count expects one argument, got %d", len(args))
+	}
+	return nil
+}
+
+func (a *countAccumulator) Merge(other Accumulator) error {
+	o, ok := other.(*countAccumulator)
+	if !ok {
+		return fmt.Errorf("can't merge %T into count", other)
+	}
+	a.n += o.n
+	return nil
+}
+
+func (a *countAccumulator) Final() (Value, error) {
+	return Value{Int, a.n}, nil
+}
+
+// min(x) returns the smallest value of x, skipping NULLs.
+type minAccumulator struct {
+	set bool
+	min Value
+}
+
+func (a *minAccumulator) Step(args []Value) error {
+	if len(args) != 1 {
+		return fmt.Errorf("min expects one argument, got %d", len(args))
+	}
+	if args[0].Data == nil {
+		return nil
+	}
+	return a.add(args[0])
+}
+
+func (a *minAccumulator) add(v Value) error {
+	if !a.set {
+		a.set = true
+		a.min = v
+		return nil
+	}
+	less, err := v.lessThan(a.min)
+	if err != nil {
+		return err
+	}
+	if less {
+		a.min = v
+	}
+	return nil
+}
+
+func (a *minAccumulator) Merge(other Accumulator) error {
+	o, ok := other.(*minAccumulator)
+	if !ok {
+		return fmt.Errorf("can't merge %T into min", other)
+	}
+	if !o.set {
+		return nil
+	}
+	return a.add(o.min)
+}
+
+func (a *minAccumulator) Final() (Value, error) {
+	if !a.set {
+		return Value{Int, nil}, nil
+	}
+	return a.min, nil
+}
+
+// findAggregates returns all aggregate nodes used in the query's selectors
+// and orderings.
+func findAggregates(Q Query) []*aggregate {
+	var r []*aggregate
+	collect := func(x any) error {
+		if a, ok := x.(*aggregate); ok {
+			r = append(r, a)
+		}
+		return nil
+	}
+	for _, s := range Q.Selectors {
+		traverse(s.Expr, collect)
+	}
+	for _, o := range Q.OrderBy {
+		traverse(o.expr, collect)
+	}
+	return r
+}
+
+// containsAggregate tells whether the expression has aggregates in it.
+func containsAggregate(expr expression) bool {
+	found := false
+	traverse(expr, func(x any) error {
+		if _, ok := x.(*aggregate); ok {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+// groupState is a group being accumulated: its first row and the running
+// states of the query's aggregates.
+type groupState struct {
+	e    Engine
+	row  Row
+	accs map[*aggregate]Accumulator
+}
+
+func newGroupState(e Engine, aggs []*aggregate) (*groupState, error) {
+	g := &groupState{e: e, accs: map[*aggregate]Accumulator{}}
+	for _, a := range aggs {
+		acc, err := e.newAccumulator(a)
+		if err != nil {
+			return nil, err
+		}
+		g.accs[a] = acc
+	}
+	return g, nil
+}
+
+func (g *groupState) step(r Row) error {
+	if g.row == nil {
+		g.row = r
+	}
+	for a, acc := range g.accs {
+		var args []Value
+		for _, arg := range a.Args {
+			if _, ok := arg.(*star); ok {
+				continue
+			}
+			v, err := g.e.evalOn(arg, r, nil)
+			if err != nil {
+				return err
+			}
+			args = append(args, v)
+		}
+		if err := acc.Step(args); err != nil {
+			return fmt.Errorf("%s: %w", a, err)
+		}
+	}
+	return nil
+}
+
+func (g *groupState) final() (group, error) {
+	result := group{g.row, map[*aggregate]Value{}}
+	for a, acc := range g.accs {
+		v, err := acc.Final()
+		if err != nil {
+			return group{}, err
+		}
+		result.aggs[a] = v
+	}
+	return result, nil
+}
+
+// merge adds the state of the same group computed over the rows that follow
+// the rows of this state.
+func (g *groupState) merge(o *groupState) error {
+	if g.row == nil {
+		g.row = o.row
+	}
+	for a, acc := range g.accs {
+		if err := acc.Merge(o.accs[a]); err != nil {
+			return fmt.Errorf("%s: %w", a, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,460 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// scope is the set of columns an expression can refer to.
+type scope struct {
+	columns []scopeColumn
+
+	// partial is set if rows may have columns that are not listed, so
+	// unknown columns can't be rejected before execution.
+	partial bool
+}
+
+type scopeColumn struct {
+	table  string
+	column Column
+}
+
+func (s *scope) add(table string, t Table) error {
+	columns, err := t.Columns()
+	if err != nil {
+		return err
+	}
+	for _, c := range columns {
+		s.columns = append(s.columns, scopeColumn{table, c})
+	}
+	if p, ok := t.(interface{ partialColumns() bool }); ok && p.partialColumns() {
+		s.partial = true
+	}
+	return nil
+}
+
+// resolve finds the referenced column the same way evalColumnRef finds its
+// cell.
+func (s *scope) resolve(ref *columnRef) (Column, error) {
+	for _, c := range s.columns {
+		if ref.Table != "" && !strings.EqualFold(ref.Table, c.table) {
+			continue
+		}
+		if strings.EqualFold(ref.Column, c.column.Name) {
+			return c.column, nil
+		}
+	}
+	if ref.Table != "" {
+		if c, err := s.resolve(&columnRef{Column: ref.Table + "." + ref.Column}); err == nil {
+			return c, nil
+		}
+	}
+	if s.partial {
+		return Column{Name: ref.Column, Type: Any, Nullable: true}, nil
+	}
+	return Column{}, fmt.Errorf("unknown column %s", ref)
+}
+
+// bind checks the query against the schemas of its tables before it runs:
+// it resolves column references, checks function calls and operand types,
+// and checks that aggregates are used only where they can be computed. It
+// returns a copy of the query with the column references annotated with
+// their types.
+func (e Engine) bind(q Query) (Query, error) {
+	r, _, err := e.bindQuery(q)
+	if err != nil {
+		return r, err
+	}
+	// Parameters get their values in prepared statements, see Stmt.
+	err = traverse(&r, func(x any) error {
+		if p, ok := x.(*placeholder); ok {
+			return fmt.Errorf("unbound parameter %s", p)
+		}
+		return nil
+	})
+	return r, err
+}
+
+// bindQuery binds the query and returns its output columns.
+func (e Engine) bindQuery(q Query) (Query, *scope, error) {
+	if q.Distinct && (len(q.GroupBy) > 0 || len(findAggregates(q)) > 0) {
+		outer, err := distinctGroups(q)
+		if err != nil {
+			return q, nil, err
+		}
+		return e.bindQuery(outer)
+	}
+	r := q
+	sc := &scope{}
+	switch v := q.From.(type) {
+	case nil:
+	case *tableName:
+		t, err := findTable(e, v.Name)
+		if err != nil {
+			return r, nil, err
+		}
+		if err := sc.add(v.Name, t); err != nil {
+			return r, nil, err
+		}
+	case *describe:
+		if _, err := findTable(e, v.Table); err != nil {
+			return r, nil, err
+		}
+		sc.columns = []scopeColumn{
+			{"", Column{"name", String, false}},
+			{"", Column{"type", String, false}},
+			{"", Column{"nullable", Bool, false}},
+		}
+	case *explain:
+		sub, _, err := e.bindQuery(v.Query)
+		if err != nil {
+			return r, nil, err
+		}
+		r.From = &explain{sub, v.Analyze}
+		sc.columns = []scopeColumn{{"", Column{"plan", String, false}}}
+	case *Query:
+		sub, out, err := e.bindQuery(*v)
+		if err != nil {
+			return r, nil, err
+		}
+		r.From = &sub
+		sc = out
+	}
+
+	r.Joins = nil
+	for _, j := range q.Joins {
+		t, ok := e.tables[j.Table.Name]
+		if !ok {
+			return r, nil, fmt.Errorf("table not found: %s", j.Table.Name)
+		}
+		if err := sc.add(j.Table.Name, t); err != nil {
+			return r, nil, err
+		}
+		cond, err := e.bindCondition(j.Condition, sc, "ON")
+		if err != nil {
+			return r, nil, err
+		}
+		r.Joins = append(r.Joins, joinspec{j.Table, cond})
+	}
+
+	var err error
+	if q.Filter != nil {
+		r.Filter, err = e.bindCondition(q.Filter, sc, "WHERE")
+		if err != nil {
+			return r, nil, err
+		}
+	}
+	r.GroupBy = nil
+	for _, g := range q.GroupBy {
+		x, err := e.bindExpr(g, sc, "GROUP BY")
+		if err != nil {
+			return r, nil, err
+		}
+		r.GroupBy = append(r.GroupBy, x)
+	}
+	r.Selectors = nil
+	for _, s := range q.Selectors {
+		x, err := e.bindExpr(s.Expr, sc, "")
+		if err != nil {
+			return r, nil, err
+		}
+		r.Selectors = append(r.Selectors, selector{x, s.Alias})
+	}
+	r.OrderBy = nil
+	for _, o := range q.OrderBy {
+		x, err := e.bindExpr(o.expr, sc, "")
+		if err != nil {
+			return r, nil, err
+		}
+		r.OrderBy = append(r.OrderBy, orderspec{o.desc, x})
+	}
+
+	// DISTINCT groups the rows by the selected expressions.
+	if r.Distinct {
+		for _, s := range r.Selectors {
+			r.GroupBy = append(r.GroupBy, s.Expr)
+		}
+		for _, o := range r.OrderBy {
+			if checkGrouped(o.expr, r.GroupBy) != nil {
+				return r, nil, fmt.Errorf("ORDER BY %s must be in the select list with DISTINCT", o.expr)
+			}
+		}
+	}
+
+	// With grouping or aggregates, every row stands for a group, so only
+	// the grouped expressions and aggregates have a single value.
+	if len(r.GroupBy) > 0 || len(findAggregates(r)) > 0 {
+		for _, s := range r.Selectors {
+			if err := checkGrouped(s.Expr, r.GroupBy); err != nil {
+				return r, nil, err
+			}
+		}
+		for _, o := range r.OrderBy {
+			if err := checkGrouped(o.expr, r.GroupBy); err != nil {
+				return r, nil, err
+			}
+		}
+	}
+
+	out := &scope{}
+	for _, s := range r.Selectors {
+		if _, ok := s.Expr.(*star); ok {
+			for _, c := range sc.columns {
+				out.columns = append(out.columns, scopeColumn{"", c.column})
+			}
+			out.partial = out.partial || sc.partial
+			continue
+		}
+		name := s.Alias
+		if name == "" {
+			name = s.Expr.String()
+		}
+		out.columns = append(out.columns, scopeColumn{"", Column{name, e.staticType(s.Expr), true}})
+	}
+	return r, out, nil
+}
+
+// distinctGroups returns the query that selects the distinct rows of a
+// query with grouping or aggregates: the query without DISTINCT, ORDER BY
+// and LIMIT as a subquery of a DISTINCT query that orders and limits its
+// rows.
+func distinctGroups(q Query) (Query, error) {
+	inner := q
+	inner.Distinct = false
+	inner.OrderBy = nil
+	inner.Limit.Set = false
+	outer := Query{Distinct: true, From: &inner, Limit: q.Limit}
+	for _, s := range q.Selectors {
+		name := s.Alias
+		if name == "" {
+			name = s.Expr.String()
+		}
+		outer.Selectors = append(outer.Selectors, selector{&columnRef{Column: name}, name})
+	}
+	for _, o := range q.OrderBy {
+		i := -1
+		for j, s := range q.Selectors {
+			ref, ok := o.expr.(*columnRef)
+			alias := ok && s.Alias != "" && ref.Table == "" && strings.EqualFold(ref.Column, s.Alias)
+			if alias || strings.EqualFold(o.expr.String(), s.Expr.String()) {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return q, fmt.Errorf("ORDER BY %s must be in the select list with DISTINCT", o.expr)
+		}
+		outer.OrderBy = append(outer.OrderBy, orderspec{o.desc, outer.Selectors[i].Expr})
+	}
+	return outer, nil
+}
+
+// bindCondition binds an expression that must be boolean.
+func (e Engine) bindCondition(x expression, sc *scope, clause string) (expression, error) {
+	r, err := e.bindExpr(x, sc, clause)
+	if err != nil {
+		return nil, err
+	}
+	if t := e.staticType(r); t != Any && t != Bool {
+		return nil, fmt.Errorf("%s condition is %s, not Bool: %s", clause, getTypeName(t), x)
+	}
+	return r, nil
+}
+
+// bindExpr returns a copy of the expression with the column references
+// resolved in the scope. clause names the clause where aggregates are not
+// allowed, or is empty.
+func (e Engine) bindExpr(x expression, sc *scope, clause string) (expression, error) {
+	return transform(x, func(x expression) (expression, error) {
+		switch v := x.(type) {
+		case *columnRef:
+			c, err := sc.resolve(v)
+			if err != nil {
+				return nil, err
+			}
+			return &columnRef{v.Table, v.Column, c.Type, sc.partial}, nil
+
+		case *placeholder:
+			return v, nil
+
+		case *aggregate:
+			if clause != "" {
+				return nil, fmt.Errorf("aggregate %s is not allowed in %s", v, clause)
+			}
+			if _, err := e.newAccumulator(v); err != nil {
+				return nil, err
+			}
+			for _, a := range v.Args {
+				if containsAggregate(a) {
+					return nil, fmt.Errorf("aggregate %s can't contain aggregates", v)
+				}
+			}
+			if _, ok := builtinAggregates[strings.ToLower(v.Name)]; ok && e.functions[strings.ToLower(v.Name)] == nil {
+				if len(v.Args) != 1 {
+					return nil, fmt.Errorf("the %s aggregate expects 1 argument, got %d", strings.ToUpper(v.Name), len(v.Args))
+				}
+				if _, ok := v.Args[0].(*star); ok && strings.ToLower(v.Name) != "count" {
+					return nil, fmt.Errorf("the %s aggregate can't be applied to *", strings.ToUpper(v.Name))
+				}
+			}
+			return v, nil
+
+		case *functionkek:
+			return v, e.checkCall(v)
+
+		case *binaryOperatorNode:
+			a, b := e.staticType(v.left), e.staticType(v.right)
+			// A parameter takes the type of the value it's compared with.
+			if p, ok := v.left.(*placeholder); ok && b != Any {
+				return &binaryOperatorNode{v.op, &placeholder{p.Text, p.Index, p.Name, b}, v.right}, nil
+			}
+			if p, ok := v.right.(*placeholder); ok && a != Any {
+				return &binaryOperatorNode{v.op, v.left, &placeholder{p.Text, p.Index, p.Name, a}}, nil
+			}
+			if a == Any || b == Any {
+				return v, nil
+			}
+			numeric := (a == Int || a == Double) && (b == Int || b == Double)
+			if a != b && !numeric {
+				return nil, fmt.Errorf("can't compare %s and %s: %s", getTypeName(a), getTypeName(b), v)
+			}
+			if a == Array || a == JSON {
+				return nil, fmt.Errorf("can't compare values of type %s: %s", getTypeName(a), v)
+			}
+			return v, nil
+
+		case *fbinaryOr:
+			for _, side := range []expression{v.left, v.right} {
+				if t := e.staticType(side); t != Any && t != Bool {
+					return nil, fmt.Errorf("OR operand is %s, not Bool: %s", getTypeName(t), side)
+				}
+			}
+			return v, nil
+
+		case *fbinaryAnd:
+			for _, side := range []expression{v.left, v.right} {
+				if t := e.staticType(side); t != Any && t != Bool {
+					return nil, fmt.Errorf("AND operand is %s, not Bool: %s", getTypeName(t), side)
+				}
+			}
+			return v, nil
+		}
+		return x, nil
+	})
+}
+
+// checkCall checks that the function exists and that its arguments match
+// its signature.
+func (e Engine) checkCall(f *functionkek) error {
+	name := strings.ToLower(f.Name)
+	if name == "cast" {
+		if len(f.Args) != 1 {
+			return fmt.Errorf("cast expects one argument, got %d", len(f.Args))
+		}
+		if _, ok := f.Args[0].(*as); !ok {
+			return fmt.Errorf("cast expects an AS argument, got %s", f.Args[0].String())
+		}
+		return nil
+	}
+	types := make([]ValueTypeID, len(f.Args))
+	for i, a := range f.Args {
+		if _, ok := a.(*as); ok {
+			return fmt.Errorf("AS is allowed only in CAST: %s", f)
+		}
+		types[i] = e.staticType(a)
+	}
+	if fn, ok := e.functions[name]; ok {
+		return fn.checkArgs(types)
+	}
+	sigs, ok := builtinFunctions[name]
+	if !ok {
+		return fmt.Errorf("unknown function %s", f.Name)
+	}
+	var counts []string
+	for _, sig := range sigs {
+		if len(sig.Args) == len(types) {
+			return (&scalarFunction{name: f.Name, sig: sig}).checkArgs(types)
+		}
+		counts = append(counts, fmt.Sprint(len(sig.Args)))
+	}
+	return fmt.Errorf("the %s function expects %s arguments, got %d", strings.ToUpper(f.Name), alternatives(counts), len(types))
+}
+
+// checkGrouped checks that the expression refers to columns only inside
+// aggregates or grouped expressions.
+func checkGrouped(x expression, groupBy []expression) error {
+	for _, g := range groupBy {
+		if strings.EqualFold(g.String(), x.String()) {
+			return nil
+		}
+	}
+	switch v := x.(type) {
+	case *columnRef:
+		return fmt.Errorf("column %s must appear in GROUP BY or be used in an aggregate", v)
+	case *star:
+		return fmt.Errorf("* can't be selected with GROUP BY or aggregates")
+	case *functionkek:
+		for _, a := range v.Args {
+			if err := checkGrouped(a, groupBy); err != nil {
+				return err
+			}
+		}
+	case *as:
+		return checkGrouped(v.Expr, groupBy)
+	case *binaryOperatorNode:
+		if err := checkGrouped(v.left, groupBy); err != nil {
+			return err
+		}
+		return checkGrouped(v.right, groupBy)
+	case *fbinaryOr:
+		if err := checkGrouped(v.left, groupBy); err != nil {
+			return err
+		}
+		return checkGrouped(v.right, groupBy)
+	case *fbinaryAnd:
+		if err := checkGrouped(v.left, groupBy); err != nil {
+			return err
+		}
+		return checkGrouped(v.right, groupBy)
+	}
+	return nil
+}
+
+// staticType returns the type of the expression if it can be known without
+// evaluating it, and Any otherwise.
+func (e Engine) staticType(x expression) ValueTypeID {
+	switch v := x.(type) {
+	case *Value:
+		return v.Type
+	case *columnRef:
+		return v.Type
+	case *binaryOperatorNode, *fbinaryOr, *fbinaryAnd:
+		return Bool
+	case *aggregate:
+		if e.functions[strings.ToLower(v.Name)] != nil || e.aggregates[strings.ToLower(v.Name)] != nil {
+			return Any
+		}
+		switch strings.ToLower(v.Name) {
+		case "count":
+			return Int
+		case "min":
+			if len(v.Args) == 1 {
+				return e.staticType(v.Args[0])
+			}
+		}
+	case *functionkek:
+		name := strings.ToLower(v.Name)
+		if name == "cast" && len(v.Args) == 1 {
+			if a, ok := v.Args[0].(*as); ok {
+				return a.TypeID
+			}
+		}
+		if f, ok := e.functions[name]; ok {
+			return f.sig.Result
+		}
+		if sigs := builtinFunctions[name]; len(sigs) > 0 {
+			return sigs[0].Result
+		}
+	}
+	return Any
+}
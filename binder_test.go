@@ -0,0 +1,81 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBinderErrors(t *testing.T) {
+	engine := New(map[string]Table{
+		"t": dummy{
+			{"id": Value{Int, 1}, "name": Value{String, "a"}, "tags": Value{Array, []Value{}}},
+		},
+		"u":     dummy{{"id": Value{Int, 1}, "ok": Value{Bool, true}}},
+		"empty": &memTable{columns: []Column{{"id", Int, false}}},
+	})
+	cases := []struct {
+		query string
+		err   string
+	}{
+		{`select foo from empty`, `unknown column "foo"`},
+		{`select u.name from t`, `unknown column "u"."name"`},
+		{`select id from t where name`, `WHERE condition is String, not Bool: "name"`},
+		{`select t.id from t join u on u.id`, `ON condition is Int, not Bool: "u"."id"`},
+		{`select id from t where name = 1`, `can't compare String and Int: "name" = 1`},
+		{`select id from t where tags = tags`, `can't compare values of type Array: "tags" = "tags"`},
+		{`select id from t where ok or name = 'a'`, `unknown column "ok"`},
+		{`select id from t where id or id = 1`, `OR operand is Int, not Bool: "id"`},
+		{`select substring(id, 1) from t`, `the SUBSTRING function expects argument 1 to be String, got Int`},
+		{`select substring(name) from t`, `the SUBSTRING function expects 2 or 3 arguments, got 1`},
+		{`select cardinality(name) from t`, `the CARDINALITY function expects argument 1 to be Array, got String`},
+		{`select foo(id) from t`, `unknown function foo`},
+		{`select id from t where count(*) > 1`, `aggregate count(*) is not allowed in WHERE`},
+		{`select count(*) from t group by count(id)`, `aggregate count("id") is not allowed in GROUP BY`},
+		{`select count(count(*)) from t`, `aggregate count(count(*)) can't contain aggregates`},
+		{`select min(*) from t`, `the MIN aggregate can't be applied to *`},
+		{`select id, count(*) from t`, `column "id" must appear in GROUP BY or be used in an aggregate`},
+		{`select name, count(*) from t group by id`, `column "name" must appear in GROUP BY or be used in an aggregate`},
+		{`select id from t group by id order by name`, `column "name" must appear in GROUP BY or be used in an aggregate`},
+		{`select * from t group by id`, `* can't be selected with GROUP BY or aggregates`},
+		{`select distinct count(*) from t group by id order by id`, `ORDER BY "id" must be in the select list with DISTINCT`},
+		{`select distinct id from t order by name`, `ORDER BY "name" must be in the select list with DISTINCT`},
+		{`select n from (select id from t)`, `unknown column "n"`},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			_, err := engine.ExecString(c.query)
+			if err == nil {
+				t.Fatal("expected an error, got nil")
+			}
+			if diff := cmp.Diff(c.err, err.Error()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestBinderAccepts(t *testing.T) {
+	engine := New(map[string]Table{
+		"t": dummy{
+			{"id": Value{Int, 1}, "name": Value{String, "a"}},
+			{"id": Value{Int, 2}, "name": Value{String, "a"}},
+		},
+	})
+	queries := []string{
+		`select 1, count(*) from t`,
+		`select name, count(*) from t group by name`,
+		`select substring(name, 1), count(*) from t group by substring(name, 1)`,
+		`select Name from t group by name`,
+		`select id from t where id = 1 or name = 'a'`,
+		`select cast(count(*) as string) from t`,
+		`select id from (select * from t) where id > 1`,
+	}
+	for _, q := range queries {
+		t.Run(q, func(t *testing.T) {
+			if _, err := engine.ExecString(q); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -1,46 +1,167 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
 
 	"github.com/gaswelder/sql"
 )
 
 func main() {
+	schemaPath := flag.String("schema", "", "path to a JSON file with the table's schema")
+	recordPath := flag.String("record-path", "", "path to the array of records in JSON input, like $.data.items[*]")
+	flatten := flag.Int("flatten", 0, "turn nested JSON objects up to this depth into dotted columns")
+	onError := flag.String("on-error", "fail", "what to do with malformed rows: fail, skip or log")
+	timeout := flag.Duration("timeout", 0, "stop the query after this time, like 30s")
+	memory := flag.Int64("memory", 0, "megabytes of rows to sort or group in memory before using temporary files, 0 for no limit")
+	workers := flag.Int("workers", 1, "number of goroutines reading and aggregating multi-file input or JSON input with a schema")
 	flag.Parse()
 	args := flag.Args()
 	if len(args) != 2 {
-		os.Stderr.WriteString(fmt.Sprintf("usage: %s <json-file> <query>\n", os.Args[0]))
+		os.Stderr.WriteString(fmt.Sprintf("usage: %s <data-file|glob|dir> <query>\n", os.Args[0]))
 		os.Exit(1)
 	}
 
-	var f io.Reader
+	var schema *sql.Schema
+	if *schemaPath != "" {
+		sf, err := os.Open(*schemaPath)
+		if err != nil {
+			panic(err)
+		}
+		schema, err = sql.ReadSchema(sf)
+		sf.Close()
+		if err != nil {
+			os.Stderr.WriteString("failed to read the schema: " + err.Error() + "\n")
+			os.Exit(1)
+		}
+	}
+	policy, callback, err := errorPolicy(*onError)
+	if err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+	opts := tableOptions{schema, policy, callback, *recordPath, *flatten}
+	var table sql.Table
 	if args[0] == "-" {
-		f = os.Stdin
+		table = openTable(args[0], sql.Decompress(os.Stdin, ""), opts)
+	} else if isMultiFile(args[0]) {
+		table, err = sql.FilesTable(args[0], func(path string, r io.Reader) sql.Table {
+			return openTable(path, r, opts)
+		})
+		if err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			os.Exit(1)
+		}
 	} else {
-		f, err := os.Open(args[0])
+		file, err := os.Open(args[0])
 		if err != nil {
 			panic(err)
 		}
-		defer f.Close()
+		defer file.Close()
+		table = openTable(args[0], sql.Decompress(file, args[0]), opts)
 	}
-	e := sql.New(map[string]sql.Table{"t": sql.JsonStream(f)})
-	rows, err := e.ExecString(args[1])
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	// The first interrupt cancels the query, and the next one kills the
+	// program, as a query blocked reading its input can't see the
+	// cancellation.
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	e := sql.New(map[string]sql.Table{"t": table}).WithMemoryLimit(*memory << 20).WithWorkers(*workers)
+	rows, err := e.QueryContext(ctx, args[1])
 	if err != nil {
 		os.Stderr.WriteString(err.Error() + "\n")
 		os.Exit(1)
 	}
-	for _, r := range rows {
-		j, err := rowToJSON(r)
+	for rows.Next() {
+		j, err := rowToJSON(rows.Row())
 		if err != nil {
 			panic(err)
 		}
 		fmt.Println(j)
 	}
+	if err := rows.Err(); err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+	if t, ok := table.(interface{ Skipped() int }); ok && t.Skipped() > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d malformed rows\n", t.Skipped())
+	}
+}
+
+// isMultiFile tells whether the path is a glob pattern or a directory.
+func isMultiFile(path string) bool {
+	if strings.ContainsAny(path, "*?[") {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+type tableOptions struct {
+	schema   *sql.Schema
+	onError  sql.ErrorPolicy
+	callback func(*sql.RowError)
+	records  string
+	flatten  int
+}
+
+func errorPolicy(name string) (sql.ErrorPolicy, func(*sql.RowError), error) {
+	switch name {
+	case "fail":
+		return sql.FailOnError, nil, nil
+	case "skip":
+		return sql.SkipOnError, nil, nil
+	case "log":
+		return sql.SkipOnError, func(err *sql.RowError) {
+			os.Stderr.WriteString(err.Error() + "\n")
+		}, nil
+	default:
+		return 0, nil, fmt.Errorf("unknown error policy: %s", name)
+	}
+}
+
+// openTable returns a table reading the data in the format that matches the
+// file's extension, not counting compression extensions. JSON is assumed by
+// default.
+func openTable(path string, r io.Reader, opts tableOptions) sql.Table {
+	ext := strings.ToLower(filepath.Ext(sql.TrimCompressionExt(path)))
+	switch ext {
+	case ".csv", ".tsv":
+		csvOpts := sql.CsvOptions{
+			DetectHeader:  true,
+			Schema:        opts.schema,
+			OnError:       opts.onError,
+			ErrorCallback: opts.callback,
+		}
+		if ext == ".tsv" {
+			csvOpts.Delimiter = '\t'
+			csvOpts.LazyQuotes = true
+		}
+		return sql.CsvStream(r, csvOpts)
+	default:
+		return sql.JsonStream(r, sql.JsonOptions{
+			Schema:        opts.schema,
+			OnError:       opts.onError,
+			ErrorCallback: opts.callback,
+			RecordPath:    opts.records,
+			FlattenDepth:  opts.flatten,
+		})
+	}
 }
 
 func rowToJSON(r sql.Row) (string, error) {
@@ -0,0 +1,96 @@
+package sql
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// compressionExts maps file extensions to compression formats.
+var compressionExts = map[string]string{
+	".gz":      "gzip",
+	".gzip":    "gzip",
+	".bz2":     "bzip2",
+	".zz":      "zlib",
+	".zlib":    "zlib",
+	".deflate": "flate",
+}
+
+// Decompress returns a reader that decompresses data compressed with gzip,
+// bzip2, zlib or raw deflate. The format is chosen by the extension of name,
+// if there is one, or by the data's magic bytes. Data in no known format is
+// read as is. Errors are returned from the first Read.
+func Decompress(r io.Reader, name string) io.Reader {
+	return &decompressReader{r: r, name: name}
+}
+
+// TrimCompressionExt removes a compression extension from the file name,
+// so that "events.ndjson.gz" becomes "events.ndjson".
+func TrimCompressionExt(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if _, ok := compressionExts[ext]; ok {
+		return name[:len(name)-len(ext)]
+	}
+	return name
+}
+
+type decompressReader struct {
+	r    io.Reader
+	name string
+	dr   io.Reader
+	err  error
+}
+
+func (d *decompressReader) Read(p []byte) (int, error) {
+	if d.dr == nil && d.err == nil {
+		d.dr, d.err = d.init()
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.dr.Read(p)
+}
+
+func (d *decompressReader) init() (io.Reader, error) {
+	format := compressionExts[strings.ToLower(filepath.Ext(d.name))]
+	br := bufio.NewReader(d.r)
+	if format == "" {
+		format = sniffCompression(br)
+	}
+	switch format {
+	case "gzip":
+		return gzip.NewReader(br)
+	case "bzip2":
+		return bzip2.NewReader(br), nil
+	case "zlib":
+		return zlib.NewReader(br)
+	case "flate":
+		return flate.NewReader(br), nil
+	default:
+		return br, nil
+	}
+}
+
+// sniffCompression returns the compression format recognized by the magic
+// bytes at the reader's start, or an empty string.
+func sniffCompression(br *bufio.Reader) string {
+	head, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return "gzip"
+	case len(head) == 4 && bytes.HasPrefix(head, []byte("BZh")) && head[3] >= '1' && head[3] <= '9':
+		// The fourth byte is the block size.
+		return "bzip2"
+	case len(head) >= 2 && head[0] == 0x78 && (head[1] == 0x01 || head[1] == 0x9c || head[1] == 0xda):
+		// Other valid zlib headers are printable and could be plain text.
+		return "zlib"
+	default:
+		return ""
+	}
+}
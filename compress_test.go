@@ -0,0 +1,70 @@
+package sql
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecompress(t *testing.T) {
+	data := "{\"a\": 1}\n"
+	compress := func(w func(io.Writer) io.WriteCloser) []byte {
+		var b bytes.Buffer
+		c := w(&b)
+		c.Write([]byte(data))
+		c.Close()
+		return b.Bytes()
+	}
+	bzipped := []byte{0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xd8, 0x0a, 0xe9, 0xc6, 0x00, 0x00, 0x03, 0xd9, 0x80, 0x00, 0x10, 0x50, 0x00, 0x20, 0x10, 0x20, 0x00, 0x00, 0x0a, 0x20, 0x00, 0x31, 0x0c, 0x08, 0x20, 0x33, 0x49, 0x19, 0x19, 0x44, 0xf1, 0x77, 0x24, 0x53, 0x85, 0x09, 0x0d, 0x80, 0xae, 0x9c, 0x60}
+
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"plain.ndjson", []byte(data)},
+		{"", compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })},
+		{"", compress(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })},
+		{"", bzipped},
+		{"data.deflate", compress(func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		})},
+	}
+	for _, c := range cases {
+		got, err := io.ReadAll(Decompress(bytes.NewReader(c.data), c.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(data, string(got)); diff != "" {
+			t.Fatalf("%s", diff)
+		}
+	}
+
+	// Text that starts like bzip2 data but has no block size is plain.
+	text := "BZhome,x\n1,2\n"
+	got, err := io.ReadAll(Decompress(bytes.NewReader([]byte(text)), ""))
+	if err != nil || string(got) != text {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	// Data that is still compressed after decompressing is not decompressed
+	// again by the tables.
+	inner := compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+	var outer bytes.Buffer
+	gw := gzip.NewWriter(&outer)
+	gw.Write(inner)
+	gw.Close()
+	table := JsonStream(Decompress(&outer, ""), JsonOptions{})
+	if _, err := table.Columns(); err == nil {
+		t.Fatal("expected the inner gzip data to be read as JSON")
+	}
+
+	if got := TrimCompressionExt("events.ndjson.gz"); got != "events.ndjson" {
+		t.Fatalf("unexpected trimmed name: %s", got)
+	}
+}
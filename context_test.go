@@ -0,0 +1,47 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExecContext(t *testing.T) {
+	queries := []string{
+		`select a.n from a join b on a.n = 0`,
+		`select count(*) from a`,
+		`select n from a group by n`,
+		`select n from a order by n`,
+	}
+	for _, q := range queries {
+		t.Run(q, func(t *testing.T) {
+			e := New(map[string]Table{"a": &countingTable{}, "b": &countingTable{}})
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, err := e.ExecContext(ctx, q)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected deadline exceeded, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExecContextDone(t *testing.T) {
+	e := New(map[string]Table{"a": &countingTable{}})
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, err := e.QueryContext(ctx, `select n from a`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+	cancel()
+	if rows.Next() {
+		t.Error("Next returned true after the context was canceled")
+	}
+	if !errors.Is(rows.Err(), context.Canceled) {
+		t.Errorf("expected context canceled, got %v", rows.Err())
+	}
+}
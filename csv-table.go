@@ -0,0 +1,387 @@
+package sql
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CsvOptions configures a CSV table source.
+type CsvOptions struct {
+	// Delimiter is the field separator, comma by default.
+	Delimiter rune
+
+	// LazyQuotes allows quotes to appear in unquoted fields and non-doubled
+	// quotes to appear in quoted fields.
+	LazyQuotes bool
+
+	// NoHeader tells that the first line is data. Columns are then named
+	// c1, c2 and so on.
+	NoHeader bool
+
+	// DetectHeader tells to read the first line as data if it looks like
+	// data: if it has a field that doesn't fit the type inferred for its
+	// column from the sample, it's a header, and otherwise it's data.
+	// When all columns are strings, the first line is taken as a header.
+	DetectHeader bool
+
+	// NullValues lists field values that are read as NULL.
+	// If nil, empty fields are read as NULL.
+	NullValues []string
+
+	// SampleSize is the number of rows used to infer column types,
+	// 100 by default.
+	SampleSize int
+
+	// Schema, if set, is used instead of the inferred one. Without a header,
+	// the schema's columns are matched to the fields by position.
+	Schema *Schema
+
+	// OnError tells what to do with rows that can't be read.
+	OnError ErrorPolicy
+
+	// ErrorCallback, if set, is called for every bad row.
+	ErrorCallback func(*RowError)
+}
+
+type csvStream struct {
+	rowErrors
+	_init   bool
+	opts    CsvOptions
+	in      *bufio.Reader
+	r       *csv.Reader
+	columns []string
+	types   []ValueTypeID
+	sample  []csvRecord
+	n       int
+	last    int
+}
+
+// csvRecord is a record with its position in the input.
+type csvRecord struct {
+	fields []string
+	row    int
+	line   int
+}
+
+// CsvStream returns a table that reads CSV data from the reader. Compressed
+// data has to be decompressed by the caller, see Decompress.
+func CsvStream(r io.Reader, opts CsvOptions) *csvStream {
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ','
+	}
+	if opts.NullValues == nil {
+		opts.NullValues = []string{""}
+	}
+	if opts.SampleSize <= 0 {
+		opts.SampleSize = 100
+	}
+	in := bufio.NewReader(r)
+	cr := csv.NewReader(in)
+	cr.Comma = opts.Delimiter
+	cr.LazyQuotes = opts.LazyQuotes
+	cr.FieldsPerRecord = -1
+	return &csvStream{
+		rowErrors: rowErrors{policy: opts.OnError, callback: opts.ErrorCallback},
+		opts:      opts,
+		in:        in,
+		r:         cr,
+	}
+}
+
+func (s *csvStream) init() error {
+	if s._init {
+		return nil
+	}
+	s._init = true
+
+	// Skip the byte order mark that some editors put at the start.
+	if b, err := s.in.Peek(3); err == nil && string(b) == "\ufeff" {
+		s.in.Discard(3)
+	}
+
+	var header []string
+	headerLine := 0
+	if !s.opts.NoHeader {
+		var err error
+		header, err = s.r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		headerLine, _ = s.r.FieldPos(0)
+		s.columns, err = headerNames(header)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Read a sample of rows to infer the types from.
+	for len(s.sample) < s.opts.SampleSize {
+		rec, err := s.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if err := s.reject(err); err != nil {
+				return err
+			}
+			continue
+		}
+		s.sample = append(s.sample, rec)
+	}
+	if s.opts.DetectHeader && header != nil && !s.isHeader(header) {
+		// The first line is the first row.
+		for i := range s.sample {
+			s.sample[i].row++
+		}
+		s.sample = append([]csvRecord{{header, 1, headerLine}}, s.sample...)
+		s.n++
+		s.opts.NoHeader = true
+		s.columns = nil
+	}
+	if s.opts.Schema != nil {
+		if s.opts.NoHeader {
+			s.columns = s.opts.Schema.names()
+		}
+		return nil
+	}
+	if s.opts.NoHeader && len(s.sample) > 0 {
+		for i := range s.sample[0].fields {
+			s.columns = append(s.columns, fmt.Sprintf("c%d", i+1))
+		}
+	}
+	s.types = make([]ValueTypeID, len(s.columns))
+	for i := range s.columns {
+		s.types[i] = s.inferType(i)
+	}
+	return nil
+}
+
+// headerNames returns the column names from the header. Columns without
+// names are named by their positions, as without a header.
+func headerNames(header []string) ([]string, error) {
+	names := make([]string, len(header))
+	seen := map[string]bool{}
+	for i, name := range header {
+		if name == "" {
+			name = fmt.Sprintf("c%d", i+1)
+		}
+		if seen[strings.ToLower(name)] {
+			return nil, fmt.Errorf("duplicate column %s in the header", name)
+		}
+		seen[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names, nil
+}
+
+// isHeader tells whether the first line looks like a header rather than
+// data: whether it has a field that doesn't fit the type of its column in
+// the sample.
+func (s *csvStream) isHeader(first []string) bool {
+	typed := false
+	for i, field := range first {
+		t := s.inferType(i)
+		if t == String {
+			continue
+		}
+		typed = true
+		if s.isNull(field) {
+			continue
+		}
+		if _, err := parseCsvField(field, t); err != nil {
+			return true
+		}
+	}
+	return !typed
+}
+
+// inferType returns the narrowest type that fits all non-null values of the
+// column in the sample.
+func (s *csvStream) inferType(col int) ValueTypeID {
+	candidates := []ValueTypeID{Int, Double, Bool}
+	seen := false
+	for _, rec := range s.sample {
+		if col >= len(rec.fields) || s.isNull(rec.fields[col]) {
+			continue
+		}
+		seen = true
+		var fits []ValueTypeID
+		for _, t := range candidates {
+			if _, err := parseCsvField(rec.fields[col], t); err == nil {
+				fits = append(fits, t)
+			}
+		}
+		candidates = fits
+	}
+	if !seen || len(candidates) == 0 {
+		return String
+	}
+	return candidates[0]
+}
+
+func (s *csvStream) isNull(field string) bool {
+	for _, n := range s.opts.NullValues {
+		if field == n {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCsvField(field string, t ValueTypeID) (any, error) {
+	switch t {
+	case Int:
+		return strconv.Atoi(field)
+	case Double:
+		return strconv.ParseFloat(field, 64)
+	case Bool:
+		return strconv.ParseBool(field)
+	default:
+		return field, nil
+	}
+}
+
+// Columns returns the declared or inferred columns.
+func (s *csvStream) Columns() ([]Column, error) {
+	if s.opts.Schema != nil {
+		return s.opts.Schema.Columns, nil
+	}
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+	var r []Column
+	for i, name := range s.columns {
+		r = append(r, Column{name, s.types[i], true})
+	}
+	return r, nil
+}
+
+// read reads the next record from the input.
+func (s *csvStream) read() (csvRecord, error) {
+	fields, err := s.r.Read()
+	if err == io.EOF {
+		return csvRecord{}, err
+	}
+	s.n++
+	if pe, ok := err.(*csv.ParseError); ok {
+		return csvRecord{}, &RowError{Row: s.n, Line: pe.StartLine, Err: pe.Err}
+	}
+	if err != nil {
+		return csvRecord{}, err
+	}
+	line, _ := s.r.FieldPos(0)
+	return csvRecord{fields, s.n, line}, nil
+}
+
+// reject applies the error policy to a bad row error.
+func (s *csvStream) reject(err error) error {
+	re, ok := err.(*RowError)
+	if !ok {
+		return err
+	}
+	return s.handle(re)
+}
+
+// parse converts the record's fields to a row. If keep is not nil, only the
+// columns in it are converted.
+func (s *csvStream) parse(fields []string, keep map[string]bool) (map[string]Value, error) {
+	if len(fields) != len(s.columns) {
+		return nil, fmt.Errorf("expected %d fields, got %d", len(s.columns), len(fields))
+	}
+	if s.opts.Schema != nil {
+		values := map[string]Value{}
+		for i, name := range s.columns {
+			if s.isNull(fields[i]) {
+				values[name] = Value{String, nil}
+			} else {
+				values[name] = Value{String, fields[i]}
+			}
+		}
+		return s.opts.Schema.coerce(values)
+	}
+	row := map[string]Value{}
+	for i, name := range s.columns {
+		if keep != nil && !keep[strings.ToLower(name)] {
+			continue
+		}
+		t := s.types[i]
+		if s.isNull(fields[i]) {
+			row[name] = Value{t, nil}
+			continue
+		}
+		v, err := parseCsvField(fields[i], t)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: can't read %q as %s", name, fields[i], getTypeName(t))
+		}
+		row[name] = Value{t, v}
+	}
+	return row, nil
+}
+
+func (s *csvStream) GetRows() func() (map[string]Value, error) {
+	return s.getRows(nil)
+}
+
+// GetRowsWithColumns is GetRows that skips converting the fields of the
+// other columns.
+func (s *csvStream) GetRowsWithColumns(columns []string) func() (map[string]Value, error) {
+	return s.getRows(columnNames(columns))
+}
+
+func (s *csvStream) getRows(keep map[string]bool) func() (map[string]Value, error) {
+	return func() (map[string]Value, error) {
+		if err := s.init(); err != nil {
+			return nil, err
+		}
+		for {
+			var rec csvRecord
+			if len(s.sample) > 0 {
+				rec = s.sample[0]
+				s.sample = s.sample[1:]
+			} else {
+				var err error
+				rec, err = s.read()
+				if err == io.EOF {
+					return nil, nil
+				}
+				if err != nil {
+					if err := s.reject(err); err != nil {
+						return nil, err
+					}
+					continue
+				}
+			}
+			row, err := s.parse(rec.fields, keep)
+			if err != nil {
+				text := strings.Join(rec.fields, string(s.opts.Delimiter))
+				if err := s.handle(&RowError{rec.row, rec.line, text, err}); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			s.last = rec.line
+			return row, nil
+		}
+	}
+}
+
+// columnNames returns the set of the lower-case names.
+func columnNames(columns []string) map[string]bool {
+	r := map[string]bool{}
+	for _, c := range columns {
+		r[strings.ToLower(c)] = true
+	}
+	return r
+}
+
+// position returns the line of the last returned row.
+func (s *csvStream) position() int {
+	return s.last
+}
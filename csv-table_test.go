@@ -0,0 +1,102 @@
+package sql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCsvStream(t *testing.T) {
+	data := "id,price,name,ok\n1,1.5,one,true\n2,,two,false\n3,3,NA,true\n"
+	cases := []struct {
+		name  string
+		data  string
+		opts  CsvOptions
+		query string
+		want  []map[string]any
+	}{
+		{
+			"inferred types",
+			data,
+			CsvOptions{},
+			`select id, price, name from t where ok = true`,
+			[]map[string]any{
+				{`"id"`: 1, `"price"`: 1.5, `"name"`: "one"},
+				{`"id"`: 3, `"price"`: 3.0, `"name"`: "NA"},
+			},
+		},
+		{
+			"null markers",
+			data,
+			CsvOptions{NullValues: []string{"", "NA"}},
+			`select count(name) as n from t`,
+			[]map[string]any{{"n": 2}},
+		},
+		{
+			"tsv without header",
+			"a\t1\nb\t2\n",
+			CsvOptions{Delimiter: '\t', NoHeader: true},
+			`select c1 from t where c2 > 1`,
+			[]map[string]any{{`"c1"`: "b"}},
+		},
+		{
+			"type inferred from the whole sample",
+			"x\n1\n2\nthree\n",
+			CsvOptions{},
+			`select x from t where x = '1'`,
+			[]map[string]any{{`"x"`: "1"}},
+		},
+		{
+			"byte order mark",
+			"\ufeffid,name\n1,one\n",
+			CsvOptions{},
+			`select id from t`,
+			[]map[string]any{{`"id"`: 1}},
+		},
+		{
+			"unnamed column",
+			"id,\n1,one\n",
+			CsvOptions{},
+			`select c2 from t`,
+			[]map[string]any{{`"c2"`: "one"}},
+		},
+		{
+			"detected header",
+			"id,name\n1,one\n2,two\n",
+			CsvOptions{DetectHeader: true},
+			`select count(*) as n, min(id) as m from t`,
+			[]map[string]any{{"n": 2, "m": 1}},
+		},
+		{
+			"detected data",
+			"1,one\n2,two\n",
+			CsvOptions{DetectHeader: true},
+			`select count(*) as n, min(c1) as m from t`,
+			[]map[string]any{{"n": 2, "m": 1}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			engine := New(map[string]Table{"t": CsvStream(strings.NewReader(c.data), c.opts)})
+			r, err := engine.ExecString(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(rowsAsJSON(r), c.want); diff != "" {
+				t.Fatalf("%s", diff)
+			}
+		})
+	}
+}
+
+func TestCsvStreamDuplicateHeader(t *testing.T) {
+	engine := New(map[string]Table{"t": CsvStream(strings.NewReader("a,A\n1,2\n"), CsvOptions{})})
+	_, err := engine.ExecString(`select * from t`)
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if diff := cmp.Diff("duplicate column A in the header", err.Error()); diff != "" {
+		t.Fatalf("%s", diff)
+	}
+}
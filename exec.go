@@ -1,8 +1,9 @@
 package sql
 
 import (
+	"container/heap"
+	"context"
 	"fmt"
-	"reflect"
 	"sort"
 	"strings"
 )
@@ -22,32 +23,159 @@ type Cell struct {
 
 // Engine parses and executes SQL queries.
 type Engine struct {
-	tables map[string]Table
+	tables     map[string]Table
+	functions  map[string]*scalarFunction
+	aggregates map[string]func() Accumulator
+
+	// memoryLimit, if not zero, is the number of bytes of rows that sorting
+	// and grouping keep in memory before they spill to temporary files.
+	memoryLimit int64
+
+	// workers is the number of goroutines that read and aggregate the
+	// tables that can be read in parts. Below two, queries run on the
+	// calling goroutine.
+	workers int
 }
 
+// Table is a source of rows.
 type Table interface {
+	// GetRows returns a function that returns the next row on each call
+	// and nil when there are no more rows.
 	GetRows() func() (map[string]Value, error)
-	ColumnNames() []string
+
+	// Columns returns the table's columns in a stable order.
+	Columns() ([]Column, error)
+}
+
+// ClosableTable is a Table whose row iterators hold resources, such as open
+// files or goroutines. The engine reads such tables with GetClosableRows and
+// calls the returned close function when a query stops reading early.
+type ClosableTable interface {
+	Table
+
+	// GetClosableRows is GetRows that also returns a function that releases
+	// the iterator's resources.
+	GetClosableRows() (next func() (map[string]Value, error), close func() error)
+}
+
+// ProjectableTable is a Table that can skip reading the columns a query
+// doesn't need.
+type ProjectableTable interface {
+	Table
+
+	// GetRowsWithColumns is GetRows that needs to return only the given
+	// columns. The names are matched without regard to case and may include
+	// names the table doesn't have. Extra columns in the rows are ignored.
+	GetRowsWithColumns(columns []string) func() (map[string]Value, error)
+}
+
+// FilterableTable is a Table that can skip the rows a query doesn't need,
+// for example by looking them up by key.
+type FilterableTable interface {
+	Table
+
+	// PushFilter returns a table with only the rows for which all of the
+	// comparisons are true, and the comparisons that the returned table
+	// doesn't apply. Those have to be a subset of the given ones, and the
+	// engine applies them to the rows itself.
+	PushFilter(filter []Comparison) (Table, []Comparison)
+}
+
+// Comparison is a condition that compares a column with a constant.
+type Comparison struct {
+	// Column is the name of a column of the table.
+	Column string
+
+	// Op is one of "=", "<" and ">".
+	Op string
+
+	Value Value
+}
+
+// Match tells whether the comparison is true for the column's value.
+func (c Comparison) Match(v Value) (bool, error) {
+	switch c.Op {
+	case "=":
+		return v.eq(c.Value)
+	case "<":
+		return v.lessThan(c.Value)
+	case ">":
+		return v.greaterThan(c.Value)
+	}
+	return false, fmt.Errorf("unsupported comparison operator: %s", c.Op)
+}
+
+func (c Comparison) String() string {
+	return (&binaryOperatorNode{c.Op, &columnRef{Column: c.Column}, &c.Value}).String()
 }
 
 // New returns a new instance of the SQL engine.
 func New(tables map[string]Table) Engine {
-	return Engine{tables}
+	return Engine{
+		tables:     tables,
+		functions:  map[string]*scalarFunction{},
+		aggregates: map[string]func() Accumulator{},
+	}
 }
 
 // ExecString parses and executes a string SQL query agains the backend.
 func (e Engine) ExecString(sql string) ([]Row, error) {
-	q, err := Parse(sql)
+	return e.ExecContext(context.Background(), sql)
+}
+
+// ExecContext is ExecString that stops the execution with the context's
+// error when the context is done.
+func (e Engine) ExecContext(ctx context.Context, sql string) ([]Row, error) {
+	q, err := e.Parse(sql)
 	if err != nil {
 		return nil, err
 	}
-	s, err := e.Exec(q)
+	s, err := e.execContext(ctx, q)
 	if err != nil {
 		return nil, err
 	}
 	return s.Consume()
 }
 
+// WithMemoryLimit returns a copy of the engine that keeps about the given
+// number of bytes of rows in memory when it sorts or groups them, and writes
+// the rest to temporary files. Zero means no limit.
+func (e Engine) WithMemoryLimit(bytes int64) Engine {
+	e.memoryLimit = bytes
+	return e
+}
+
+// WithWorkers returns a copy of the engine that reads tables made of several
+// files, and JSON streams with a schema, with n goroutines at a time. The
+// goroutines also filter the rows and compute partial aggregates, which are
+// merged in the order of the input. The results are the same as with one
+// goroutine, the default. Functions and aggregates registered on the engine
+// must be safe to call from several goroutines, and error callbacks of the
+// tables may see bad rows out of order.
+func (e Engine) WithWorkers(n int) Engine {
+	e.workers = n
+	return e
+}
+
+// cancelable returns the stream that fails with the context's error once the
+// context is done.
+func cancelable[T any](ctx context.Context, s *Stream[T]) *Stream[T] {
+	if ctx.Done() == nil {
+		return s
+	}
+	return &Stream[T]{
+		s.name,
+		func() (T, bool, error) {
+			if err := ctx.Err(); err != nil {
+				var t T
+				return t, false, err
+			}
+			return s.Next()
+		},
+		s.Close,
+	}
+}
+
 func findTable(e Engine, name string) (Table, error) {
 	options := []string{}
 	for k := range e.tables {
@@ -64,8 +192,47 @@ func findTable(e Engine, name string) (Table, error) {
 	return e.tables[options[0]], nil
 }
 
+// tableRows returns the function that reads the table's rows and the
+// function that releases the reader, which may be nil. Tables made of files
+// skip the files for which the filter is false. Projectable tables that are
+// not closable, and the tables of the files, read only the given columns
+// unless columns is nil.
+func (e Engine) tableRows(name string, table Table, filter expression, columns []string) (func() (map[string]Value, error), func() error) {
+	if ft, ok := table.(*filesTable); ok {
+		return ft.getFileRows(e.fileFilter(name, filter), columns)
+	}
+	if ct, ok := table.(ClosableTable); ok {
+		return ct.GetClosableRows()
+	}
+	if pt, ok := table.(ProjectableTable); ok && columns != nil {
+		return pt.GetRowsWithColumns(columns), nil
+	}
+	return table.GetRows(), nil
+}
+
+// fileFilter returns the function that tells whether the file of a files
+// table has to be read for the query's filter.
+func (e Engine) fileFilter(name string, filter expression) func(path string) bool {
+	if filter == nil {
+		return nil
+	}
+	return func(path string) bool {
+		// If the filter needs more than the file name, it fails to evaluate
+		// and the file has to be read.
+		row := Row{{name, "_file", Value{String, path}}}
+		v, err := e.eval(filter, row, nil)
+		return err != nil || v.Data != false
+	}
+}
+
 // Exec runs the query and returns the results.
 func (e Engine) Exec(Q Query) (*Stream[Row], error) {
+	return e.execContext(context.Background(), Q)
+}
+
+// execContext is Exec that stops the execution with the context's error
+// when the context is done.
+func (e Engine) execContext(ctx context.Context, Q Query) (*Stream[Row], error) {
 
 	// 	## SQL's logical order of operations
 	// 1. from, join, apply
@@ -87,161 +254,264 @@ func (e Engine) Exec(Q Query) (*Stream[Row], error) {
 	if len(Q.Selectors) == 0 {
 		return nil, fmt.Errorf("empty selectors list")
 	}
-	// Define the base input
-	var input *Stream[Row]
-	switch v := Q.From.(type) {
-	case nil:
-		// Empty FROM
-		input = arrstream([]Row{{}})
-	case *tableName:
-		table, err := findTable(e, v.Name)
+	Q, err := e.bind(Q)
+	if err != nil {
+		return nil, err
+	}
+	return e.exec(ctx, Q)
+}
+
+// exec runs a bound query.
+func (e Engine) exec(ctx context.Context, Q Query) (*Stream[Row], error) {
+	plan, err := e.plan(Q)
+	if err != nil {
+		return nil, err
+	}
+	s, err := e.run(ctx, e.optimize(plan), nil)
+	if err != nil {
+		return nil, err
+	}
+	return mapStream(s, func(g group) (Row, error) {
+		return g.row, nil
+	}), nil
+}
+
+// group is a set of rows reduced to its first row and the values of the
+// query's aggregates computed over the set.
+type group struct {
+	row  Row
+	aggs map[*aggregate]Value
+}
+
+// groupRows folds the input rows into groups by the key expressions and
+// computes the aggregates for each group. Without keys, all rows make one
+// group. The groups held in memory are counted in mem.
+func (e Engine) groupRows(ctx context.Context, input *Stream[group], keys []expression, aggs []*aggregate, mem *memoryUsage) (*Stream[group], error) {
+	if len(keys) == 0 {
+		return e.groupByNothing(ctx, input, aggs)
+	}
+	var groups *Stream[keyedGroup]
+	return &Stream[group]{
+		input.name + ".group",
+		func() (group, bool, error) {
+			if groups == nil {
+				seq := 0
+				next := func() (keyedGroup, bool, error) {
+					g, done, err := input.Next()
+					seq++
+					return keyedGroup{g: g, seq: seq - 1}, done, err
+				}
+				sources, err := e.accumulateGroups(ctx, next, keys, aggs, 0, mem)
+				if err != nil {
+					return group{}, false, err
+				}
+				groups = mergeSorted(sources, nil)
+			}
+			kg, done, err := groups.Next()
+			return kg.g, done, err
+		},
+		func() error {
+			err := input.Close()
+			if groups != nil {
+				if err2 := groups.Close(); err == nil {
+					err = err2
+				}
+			}
+			return err
+		},
+	}, nil
+}
+
+const (
+	// spillPartitions is the number of files the rows of the groups that
+	// don't fit in memory are split into.
+	spillPartitions = 16
+
+	// maxSpillDepth limits how many times the partitions split further.
+	maxSpillDepth = 4
+)
+
+// accumulateGroups reads the input and folds the rows into groups according
+// to the given key expressions. Only one row and one set of aggregate states
+// are kept per group. Once the groups take more memory than the engine's
+// limit, the rows of the groups that are not in memory go to partition
+// files, which are folded one at a time after the input ends. The result
+// is streams of groups, each in the order of the groups' first rows. The
+// groups held in memory are counted in mem.
+func (e Engine) accumulateGroups(ctx context.Context, next func() (keyedGroup, bool, error), keys []expression, aggs []*aggregate, depth int, mem *memoryUsage) (sources []*Stream[keyedGroup], err error) {
+	var partitions []*spillFile
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, p := range partitions {
+			if p != nil {
+				p.remove()
+			}
+		}
+		for _, s := range sources {
+			s.Close()
+		}
+	}()
+
+	index := map[string]int{}
+	var states []*groupState
+	var firsts []int
+	var size int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		in, done, err := next()
 		if err != nil {
 			return nil, err
 		}
-		input = tablestream(v.Name, table.GetRows())
-	case *Query:
-		var err error
-		input, err = e.Exec(*v)
+		if done {
+			break
+		}
+		row := in.g.row
+		key, err := e.keyValues(keys, row)
 		if err != nil {
 			return nil, err
 		}
-	default:
-		panic(fmt.Errorf("unhandled from type: %v", reflect.TypeOf(Q.From)))
-	}
-
-	// Join other inputs
-	for _, j := range Q.Joins {
-		table, ok := e.tables[j.Table.Name]
-		if !ok {
-			return nil, fmt.Errorf("table not found: %s", j.Table.Name)
+		k := groupKey(key)
+		i, ok := index[k]
+		if !ok && partitions != nil {
+			if err := partitions[partitionOf(k, depth, len(partitions))].write(in); err != nil {
+				return nil, err
+			}
+			continue
 		}
-		more := tablestream(j.Table.Name, table.GetRows())
-		input = joinTables(input, more).filter(func(r Row) (bool, error) {
-			ev, err := eval(j.Condition, r, nil)
+		if !ok {
+			g, err := newGroupState(e, aggs)
 			if err != nil {
-				return false, err
+				return nil, err
 			}
-			return ev.Data.(bool), nil
-		})
-	}
-
-	if Q.Filter != nil {
-		input = input.filter(func(r Row) (bool, error) {
-			ok, err := eval(Q.Filter, r, nil)
-			if err != nil {
-				return false, fmt.Errorf("failed to calculate filter condition: %w", err)
+			i = len(states)
+			index[k] = i
+			states = append(states, g)
+			firsts = append(firsts, in.seq)
+			n := rowSize(row) + 64*int64(len(aggs)+1)
+			size += n
+			mem.add(n)
+		}
+		if err := states[i].step(row); err != nil {
+			return nil, err
+		}
+		if partitions == nil && e.memoryLimit > 0 && size > e.memoryLimit && depth < maxSpillDepth {
+			partitions = make([]*spillFile, spillPartitions)
+			for j := range partitions {
+				if partitions[j], err = newSpillFile(nil); err != nil {
+					return nil, err
+				}
 			}
-			return ok.Data.(bool), nil
-		})
+		}
 	}
 
-	// At this state a stream of rows turns into a strem of row groups.
-	// If the group by clause is present, the groups are formed according to
-	// it. If not, each row is converted to its own group - so that the
-	// projection step could work uniformly.
-	groupsStream, err := groupRows(input, Q)
-	if err != nil {
-		return nil, err
-	}
-	if len(Q.OrderBy) > 0 {
-		groupsStream, err = orderRows(groupsStream, Q)
+	groups := make([]keyedGroup, len(states))
+	for i, s := range states {
+		g, err := s.final()
 		if err != nil {
 			return nil, err
 		}
+		groups[i] = keyedGroup{g: g, seq: firsts[i]}
 	}
-	if Q.Limit.Set {
-		groupsStream = groupsStream.limit(Q.Limit.Value)
-	}
-	return project(groupsStream, Q), nil
-}
+	sources = append(sources, arrstream(groups))
 
-func groupRows(input *Stream[Row], Q Query) (*Stream[[]Row], error) {
-	if len(Q.GroupBy) == 0 {
-		return groupByNothing(input, Q)
-	}
-
-	allRows, err := input.Consume()
-	if err != nil {
-		return nil, err
-	}
-	keyeq := func(a, b []Value) bool {
-		for i := range a {
-			if a[i].Data != b[i].Data {
-				return false
-			}
+	for len(partitions) > 0 {
+		p := partitions[0]
+		partitions = partitions[1:]
+		rows, err := p.read()
+		if err != nil {
+			return nil, err
 		}
-		return true
-	}
-	groups := [][]Row{}
-	groupKeys := [][]Value{}
-	for _, row := range allRows {
-		key := []Value{}
-		for _, e := range Q.GroupBy {
-			ev, err := eval(e, row, nil)
-			if err != nil {
-				panic(err)
-			}
-			key = append(key, ev)
+		held := mem.current()
+		subs, err := e.accumulateGroups(ctx, rows.Next, keys, aggs, depth+1, mem)
+		rows.Close()
+		if err != nil {
+			return nil, err
 		}
-
-		// find the bucket
-		i := -1
-		for j := range groupKeys {
-			if keyeq(groupKeys[j], key) {
-				i = j
-				break
-			}
+		// Only the groups of one partition are kept in memory at a time.
+		merged := mergeSorted(subs, nil)
+		run, err := writeRun(merged, aggs)
+		merged.Close()
+		mem.add(held - mem.current())
+		if err != nil {
+			return nil, err
 		}
-		if i < 0 {
-			i = len(groupKeys)
-			groupKeys = append(groupKeys, key)
-			groups = append(groups, nil)
+		groups, err := run.read()
+		if err != nil {
+			return nil, err
 		}
-		groups[i] = append(groups[i], row)
+		sources = append(sources, groups)
 	}
-	return arrstream(groups), nil
+	return sources, nil
 }
 
-func groupByNothing(input *Stream[Row], Q Query) (*Stream[[]Row], error) {
-	hasExpressions := false
-	hasAggregates := false
-	for _, x := range Q.Selectors {
-		switch x.Expr.(type) {
-		case *aggregate:
-			hasAggregates = true
-		case *columnRef, *functionkek, *Value, *star:
-			hasExpressions = true
-		default:
-			panic(fmt.Errorf("unhandled switch case: %s", reflect.TypeOf(x.Expr)))
+// keyValues returns the values of the group key expressions for the row.
+func (e Engine) keyValues(keys []expression, row Row) ([]Value, error) {
+	key := []Value{}
+	for _, k := range keys {
+		// DISTINCT * groups by all columns.
+		if _, ok := k.(*star); ok {
+			for _, c := range row {
+				key = append(key, c.Data)
+			}
+			continue
+		}
+		v, err := e.evalOn(k, row, nil)
+		if err != nil {
+			return nil, err
 		}
+		key = append(key, v)
 	}
+	return key, nil
+}
 
-	// select id, count(*)
-	if hasExpressions && hasAggregates {
-		return nil, fmt.Errorf("can't use field expressions with aggregations without group by")
+// groupKey returns a string that is equal for equal key tuples.
+func groupKey(key []Value) string {
+	sb := strings.Builder{}
+	for _, v := range key {
+		sb.WriteString(fmt.Sprintf("%#v;", v.Data))
 	}
+	return sb.String()
+}
 
-	// select id
-	if hasExpressions {
-		return mapStream(input, func(r Row) ([]Row, error) {
-			return []Row{r}, nil
-		}), nil
-	}
+func (e Engine) groupByNothing(ctx context.Context, input *Stream[group], aggs []*aggregate) (*Stream[group], error) {
 	// select count(*)
+	// Mixing columns and aggregates is rejected by the binder.
+	state, err := newGroupState(e, aggs)
+	if err != nil {
+		return nil, err
+	}
 	init := false
-	return &Stream[[]Row]{
-		"all rows as one group " + FormatQuery(Q),
-		func() ([]Row, bool, error) {
+	return &Stream[group]{
+		input.name + ".group",
+		func() (group, bool, error) {
 			if init {
-				return nil, true, nil
+				return group{}, true, nil
 			}
 			init = true
-			rows, err := input.Consume()
-			if err != nil {
-				return nil, false, err
+			for {
+				if err := ctx.Err(); err != nil {
+					return group{}, false, err
+				}
+				g, done, err := input.Next()
+				if err != nil {
+					return group{}, false, err
+				}
+				if done {
+					break
+				}
+				if err := state.step(g.row); err != nil {
+					return group{}, false, err
+				}
 			}
-			return rows, false, nil
-		}}, nil
+			g, err := state.final()
+			return g, false, err
+		},
+		input.Close,
+	}, nil
 }
 
 func concatRows(a, b Row) Row {
@@ -258,9 +528,9 @@ func concatRows(a, b Row) Row {
 	return r
 }
 
-func joinTables(xs, ys *Stream[Row]) *Stream[Row] {
+func joinTables(xs, ys *Stream[group]) *Stream[group] {
 	var err error
-	var left, right Row
+	var left, right group
 	var leftdone bool
 	var rightdone bool
 
@@ -292,69 +562,345 @@ func joinTables(xs, ys *Stream[Row]) *Stream[Row] {
 		}
 	}
 
-	return &Stream[Row]{
+	return &Stream[group]{
 		fmt.Sprintf("join(%s,%s)", xs.name, ys.name),
-		func() (Row, bool, error) {
+		func() (group, bool, error) {
 			advance()
 			if err != nil {
-				return nil, false, err
+				return group{}, false, err
 			}
 			if leftdone || rightdone {
-				return nil, true, nil
+				return group{}, true, nil
 			}
-			return concatRows(left, right), false, nil
+			return group{row: concatRows(left.row, right.row)}, false, nil
+		},
+		func() error {
+			err := xs.Close()
+			if err2 := ys.Close(); err == nil {
+				err = err2
+			}
+			return err
 		},
 	}
 }
 
-func orderRows(s *Stream[[]Row], q Query) (*Stream[[]Row], error) {
-	groups, err := s.Consume()
-	if err != nil {
-		return nil, err
+// orderRows returns the stream of the input groups sorted by the order
+// specs. The input is read and sorted on the first call to Next.
+func (e Engine) orderRows(ctx context.Context, s *Stream[group], orderBy []orderspec, mem *memoryUsage) *Stream[group] {
+	var sorted *Stream[keyedGroup]
+	return &Stream[group]{
+		s.name + ".sort",
+		func() (group, bool, error) {
+			if sorted == nil {
+				var err error
+				sorted, err = e.sortGroups(ctx, s, orderBy, mem)
+				if err != nil {
+					return group{}, false, err
+				}
+			}
+			kg, done, err := sorted.Next()
+			return kg.g, done, err
+		},
+		func() error {
+			err := s.Close()
+			if sorted != nil {
+				if err2 := sorted.Close(); err == nil {
+					err = err2
+				}
+			}
+			return err
+		},
 	}
-	result := make([][]Row, len(groups))
-	copy(result, groups)
-	sort.Slice(result, func(i, j int) bool {
-		for _, ordering := range q.OrderBy {
-			v1, err := eval(ordering.expr, result[i][0], result[i])
-			if err != nil {
-				panic(err)
+}
+
+// sortGroups reads the input to the end and sorts it. Groups with equal
+// keys keep their input order. Once the groups read take more memory than
+// the engine's limit, they are sorted and written to a temporary file, and
+// the sorted files are merged in the end. The groups held in memory are
+// counted in mem.
+func (e Engine) sortGroups(ctx context.Context, s *Stream[group], orderBy []orderspec, mem *memoryUsage) (sorted *Stream[keyedGroup], err error) {
+	defer s.Close()
+	var runs []*spillFile
+	defer func() {
+		if err != nil {
+			for _, r := range runs {
+				r.remove()
 			}
-			v2, err := eval(ordering.expr, result[j][0], result[j])
-			if err != nil {
-				panic(err)
+		}
+	}()
+
+	var chunk []keyedGroup
+	var size int64
+	var aggs []*aggregate
+	for seq := 0; ; seq++ {
+		g, done, err := s.Next()
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+		// Evaluate the sort keys once per group so that the comparisons
+		// can't fail on evaluation.
+		kg, err := e.keyGroup(g, orderBy)
+		if err != nil {
+			return nil, err
+		}
+		kg.seq = seq
+		chunk = append(chunk, kg)
+		size += groupSize(kg)
+		mem.add(groupSize(kg))
+		if e.memoryLimit > 0 && size > e.memoryLimit {
+			if err := e.sortChunk(ctx, chunk, orderBy); err != nil {
+				return nil, err
 			}
-			if v1.Data == v2.Data {
-				continue
+			if aggs == nil {
+				aggs = groupAggregates(chunk[0].g)
 			}
-			if v1.Data == nil {
-				return false
+			run, err := writeRun(arrstream(chunk), aggs)
+			if err != nil {
+				return nil, err
 			}
-			if v2.Data == nil {
-				return true
+			runs = append(runs, run)
+			mem.add(-size)
+			chunk, size = nil, 0
+		}
+	}
+	if err := e.sortChunk(ctx, chunk, orderBy); err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return arrstream(chunk), nil
+	}
+	// The runs are merged in passes so that only a limited number of them
+	// are open at a time.
+	for len(runs) > maxMergeRuns {
+		var next []*spillFile
+		for len(runs) > 0 {
+			n := maxMergeRuns
+			if n > len(runs) {
+				n = len(runs)
 			}
-			less, err := v1.lessThan(v2)
+			merged, err := mergeRuns(runs[:n], orderBy)
+			runs = runs[n:]
 			if err != nil {
-				panic(err)
+				runs = append(runs, next...)
+				return nil, err
 			}
-			if ordering.desc {
-				return !less
+			run, err := writeRun(merged, aggs)
+			if err2 := merged.Close(); err == nil {
+				err = err2
 			}
-			return less
+			if err != nil {
+				if run != nil {
+					run.remove()
+				}
+				runs = append(runs, next...)
+				return nil, err
+			}
+			next = append(next, run)
+		}
+		runs = next
+	}
+	merged, err := mergeRuns(runs, orderBy)
+	runs = nil
+	if err != nil {
+		return nil, err
+	}
+	return mergeSorted([]*Stream[keyedGroup]{merged, arrstream(chunk)}, orderBy), nil
+}
+
+// sortChunk sorts the groups by their keys. Groups with equal keys keep
+// their order.
+func (e Engine) sortChunk(ctx context.Context, chunk []keyedGroup, orderBy []orderspec) error {
+	var cmpErr error
+	sort.SliceStable(chunk, func(i, j int) bool {
+		// Once canceled or failed, finish the sort quickly and discard the
+		// result.
+		if cmpErr != nil || ctx.Err() != nil {
+			return false
+		}
+		c, err := compareKeys(chunk[i].keys, chunk[j].keys, orderBy)
+		if err != nil {
+			cmpErr = err
+			return false
 		}
-		return false
+		return c < 0
 	})
-	return arrstream(result), nil
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return cmpErr
 }
 
-func project(s *Stream[[]Row], Q Query) *Stream[Row] {
-	return mapStream(s, func(group []Row) (Row, error) {
-		var exampleRow Row
-		if len(group) > 0 {
-			exampleRow = group[0]
+// keyedGroup is a group with its sort keys.
+type keyedGroup struct {
+	g    group
+	keys []Value
+
+	// seq is the position of the group in the input.
+	seq int
+}
+
+func (e Engine) keyGroup(g group, orderBy []orderspec) (keyedGroup, error) {
+	keys := make([]Value, len(orderBy))
+	for j, ordering := range orderBy {
+		var err error
+		keys[j], err = e.evalOn(ordering.expr, g.row, g.aggs)
+		if err != nil {
+			return keyedGroup{}, err
 		}
+	}
+	return keyedGroup{g: g, keys: keys}, nil
+}
+
+// compareKeys returns a negative number if the keys a go before the keys b,
+// a positive number if they go after, and zero if they are equal. NULLs go
+// last.
+func compareKeys(a, b []Value, orderBy []orderspec) (int, error) {
+	for k, ordering := range orderBy {
+		v1 := a[k]
+		v2 := b[k]
+		if v1.Data == nil || v2.Data == nil {
+			if v1.Data == nil && v2.Data == nil {
+				continue
+			}
+			if v2.Data == nil {
+				return -1, nil
+			}
+			return 1, nil
+		}
+		less, err := v1.lessThan(v2)
+		greater := false
+		if err == nil && !less {
+			greater, err = v2.lessThan(v1)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("can't order by %s: %w", ordering.expr, err)
+		}
+		if !less && !greater {
+			continue
+		}
+		if less != ordering.desc {
+			return -1, nil
+		}
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// topRows returns the stream of the first n input groups in the order of
+// the order specs. It keeps only n groups in memory at a time. The input is
+// read on the first call to Next.
+func (e Engine) topRows(s *Stream[group], orderBy []orderspec, n int, mem *memoryUsage) *Stream[group] {
+	var sorted *Stream[group]
+	return &Stream[group]{
+		s.name + ".top",
+		func() (group, bool, error) {
+			if sorted == nil {
+				groups, err := e.topGroups(s, orderBy, n, mem)
+				if err != nil {
+					return group{}, false, err
+				}
+				sorted = arrstream(groups)
+			}
+			return sorted.Next()
+		},
+		s.Close,
+	}
+}
+
+// topGroups reads the input to the end and returns its first n groups in
+// sorted order. Groups with equal keys keep their input order. The groups
+// held in memory are counted in mem.
+func (e Engine) topGroups(s *Stream[group], orderBy []orderspec, n int, mem *memoryUsage) ([]group, error) {
+	defer s.Close()
+	if n <= 0 {
+		return nil, nil
+	}
+	h := &topHeap{orderBy: orderBy}
+	for seq := 0; ; seq++ {
+		g, done, err := s.Next()
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+		kg, err := e.keyGroup(g, orderBy)
+		if err != nil {
+			return nil, err
+		}
+		kg.seq = seq
+		if len(h.items) < n {
+			heap.Push(h, kg)
+			mem.add(groupSize(kg))
+		} else if h.after(h.items[0], kg) {
+			mem.add(groupSize(kg) - groupSize(h.items[0]))
+			h.items[0] = kg
+			heap.Fix(h, 0)
+		}
+		if h.err != nil {
+			return nil, h.err
+		}
+	}
+	// Popping the heap gives the groups from the last to the first.
+	r := make([]group, len(h.items))
+	for i := len(r) - 1; i >= 0; i-- {
+		r[i] = heap.Pop(h).(keyedGroup).g
+	}
+	return r, h.err
+}
+
+// topHeap is a heap of groups with the group that goes last on top.
+type topHeap struct {
+	items   []keyedGroup
+	orderBy []orderspec
+
+	// err is the first error in comparing keys.
+	err error
+}
+
+// after tells whether the group a goes after the group b.
+func (h *topHeap) after(a, b keyedGroup) bool {
+	r, err := before(b, a, h.orderBy)
+	if err != nil && h.err == nil {
+		h.err = err
+	}
+	return r
+}
+
+// before tells whether the group a goes before the group b. Groups with
+// equal keys go in the order of their input positions.
+func before(a, b keyedGroup, orderBy []orderspec) (bool, error) {
+	c, err := compareKeys(a.keys, b.keys, orderBy)
+	if err != nil {
+		return false, err
+	}
+	if c == 0 {
+		return a.seq < b.seq, nil
+	}
+	return c < 0, nil
+}
+
+func (h *topHeap) Len() int           { return len(h.items) }
+func (h *topHeap) Less(i, j int) bool { return h.after(h.items[i], h.items[j]) }
+func (h *topHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *topHeap) Push(x any)         { h.items = append(h.items, x.(keyedGroup)) }
+
+func (h *topHeap) Pop() any {
+	x := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return x
+}
+
+// project evaluates the selectors on each group. The resulting groups have
+// only the projected rows.
+func (e Engine) project(s *Stream[group], selectors []selector) *Stream[group] {
+	return mapStream(s, func(g group) (group, error) {
+		exampleRow := g.row
 		groupRow := make(Row, 0)
-		for _, selector := range Q.Selectors {
+		for _, selector := range selectors {
 			// Expand star selectors with full rows
 			if _, ok := selector.Expr.(*star); ok {
 				for _, c := range exampleRow {
@@ -362,9 +908,9 @@ func project(s *Stream[[]Row], Q Query) *Stream[Row] {
 				}
 				continue
 			}
-			val, err := eval(selector.Expr, exampleRow, group)
+			val, err := e.evalOn(selector.Expr, exampleRow, g.aggs)
 			if err != nil {
-				return nil, err
+				return group{}, err
 			}
 			alias := selector.Alias
 			if alias == "" {
@@ -372,6 +918,6 @@ func project(s *Stream[[]Row], Q Query) *Stream[Row] {
 			}
 			groupRow = append(groupRow, Cell{Name: alias, Data: val})
 		}
-		return groupRow, nil
+		return group{row: groupRow}, nil
 	})
 }
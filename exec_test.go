@@ -0,0 +1,143 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExecErrors(t *testing.T) {
+	// With a sample of one row, the type of "flag" is unknown before execution.
+	data := `{"id": 1, "name": "a", "tags": [1], "flag": null}
+	{"id": 2, "name": "b", "tags": [2], "flag": "yes"}
+	{"id": 3, "name": null, "tags": [3]}`
+	cases := []struct {
+		query string
+		err   string
+	}{
+		{`select id from t where flag`, `"flag": condition is String, not Bool, in Row {t.id=Int:2, t.flag=String:yes}`},
+		{`select t.id from t join u on flag`, `"flag": condition is String, not Bool`},
+		{`select id from t order by tags`, `can't order by "tags": lessThan: don't know how to compare values of type Array`},
+		{`select cardinality(flag) from t`, `the CARDINALITY function expects Array as argument 1, got String`},
+		{`select cast(name as int) from t`, `cast("name" AS Int): strconv.Atoi: parsing "a": invalid syntax, in Row`},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			e := New(map[string]Table{
+				"t": JsonStream(strings.NewReader(data), JsonOptions{SampleSize: 1}),
+				"u": JsonStream(strings.NewReader(data), JsonOptions{SampleSize: 1}),
+			})
+			_, err := e.ExecString(c.query)
+			if err == nil {
+				t.Fatal("expected an error, got nil")
+			}
+			if !strings.Contains(err.Error(), c.err) {
+				t.Errorf("expected error %q, got %q", c.err, err)
+			}
+		})
+	}
+}
+
+func TestEvalErrorContext(t *testing.T) {
+	e := New(map[string]Table{"t": JsonStream(strings.NewReader(`{"a": "x"}`), JsonOptions{})})
+	_, err := e.ExecString(`select cast(a as int) from t`)
+	var ee *EvalError
+	if !errors.As(err, &ee) {
+		t.Fatalf("expected an EvalError, got %v", err)
+	}
+	if len(ee.Row) != 1 || ee.Row[0].Name != "a" {
+		t.Errorf("unexpected error context: %q, %v", ee.Expr, ee.Row)
+	}
+}
+
+func TestNullConditions(t *testing.T) {
+	data := `{"a": 1, "b": true} {"a": 2, "b": null} {"a": 3, "b": false}`
+	e := New(map[string]Table{"t": JsonStream(strings.NewReader(data), JsonOptions{})})
+	r, err := e.ExecString(`select a from t where b or a = 3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 2 || r[0][0].Data.Data != 1 || r[1][0].Data.Data != 3 {
+		t.Errorf("unexpected rows: %v", r)
+	}
+}
+
+func TestNullComparisons(t *testing.T) {
+	data := `{"id": 1, "x": 5} {"id": 2, "x": null} {"id": 3, "x": 7} {"id": 4}`
+	cases := []struct {
+		query string
+		want  []any
+	}{
+		{`select id from t where x > 6`, []any{3}},
+		{`select id from t where x < 6`, []any{1}},
+		{`select id from t where x = x`, []any{1, 3}},
+		{`select count(*) from t where x > 100`, []any{0}},
+		{`select x > 6 from t where id = 2`, []any{nil}},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			e := New(map[string]Table{"t": JsonStream(strings.NewReader(data), JsonOptions{})})
+			r, err := e.ExecString(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []any
+			for _, row := range r {
+				got = append(got, row[0].Data.Data)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+	for _, op := range []string{"=", "<", ">"} {
+		if ok, err := (Comparison{"x", op, Value{Int, 6}}).Match(Value{Int, nil}); ok || err != nil {
+			t.Errorf("NULL %s 6 matched: %v, %v", op, ok, err)
+		}
+	}
+}
+
+func TestAndConditions(t *testing.T) {
+	data := `{"a": 1, "b": true} {"a": 2, "b": null} {"a": 3, "b": false} {"a": 4, "b": true}`
+	e := New(map[string]Table{"t": JsonStream(strings.NewReader(data), JsonOptions{})})
+	r, err := e.ExecString(`select a from t where b and a = 4 or a = 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 2 || r[0][0].Data.Data != 1 || r[1][0].Data.Data != 4 {
+		t.Errorf("unexpected rows: %v", r)
+	}
+}
+
+func TestOrderStable(t *testing.T) {
+	var data strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&data, `{"n": %d, "k": %d}`+"\n", i, i%3)
+	}
+	for _, q := range []string{
+		`select n from t order by k`,
+		`select n from t order by k limit 40`,
+		`select n from t order by k desc limit 40`,
+	} {
+		t.Run(q, func(t *testing.T) {
+			e := New(map[string]Table{"t": JsonStream(strings.NewReader(data.String()), JsonOptions{})})
+			rows, err := e.ExecString(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Within each key, the rows have to keep the input order.
+			last := map[int]int{}
+			for _, r := range rows {
+				n := r[0].Data.Data.(int)
+				if prev, ok := last[n%3]; ok && prev > n {
+					t.Fatalf("%d goes after %d", n, prev)
+				}
+				last[n%3] = n
+			}
+			if strings.Contains(q, "limit") && len(rows) != 40 {
+				t.Errorf("got %d rows", len(rows))
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package sql
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type filesTable struct {
+	paths   []string
+	open    func(path string, r io.Reader) Table
+	columns *columnSet
+
+	// merged has the paths of the files whose columns are merged into
+	// columns.
+	merged map[string]bool
+
+	// partial is set if some file may have columns beyond its sample.
+	partial bool
+}
+
+// FilesTable returns a table that reads the files matching the glob pattern
+// one after another. If the pattern names a directory, all files in it are
+// read. open is called to create a table for each file with the file's
+// decompressed data, see Decompress.
+//
+// The table has two virtual columns: _file with the file's path and _line
+// with the row's line in the file. The columns of the files a query reads
+// are merged, with types widened where they differ. The files are read
+// twice: once to get their columns and once to get the rows. Files that a
+// query skips by _file are not opened.
+func FilesTable(pattern string, open func(path string, r io.Reader) Table) (*filesTable, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		paths, err = filepath.Glob(filepath.Join(pattern, "*"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files match %s", pattern)
+	}
+	return &filesTable{paths: files, open: open, columns: &columnSet{}, merged: map[string]bool{}}, nil
+}
+
+// Columns returns the merged columns of the files read so far followed by
+// the virtual columns. The files are not opened to get their columns before
+// they are read, so that the files a query skips are never opened.
+func (t *filesTable) Columns() ([]Column, error) {
+	r := append([]Column{}, t.columns.columns...)
+	return append(r, Column{"_file", String, false}, Column{"_line", Int, true}), nil
+}
+
+// partialColumns tells whether some file may have columns that Columns
+// doesn't list.
+func (t *filesTable) partialColumns() bool {
+	return t.partial || len(t.merged) < len(t.paths)
+}
+
+func (t *filesTable) GetRows() func() (map[string]Value, error) {
+	next, _ := t.getFileRows(nil, nil)
+	return next
+}
+
+// GetRowsWithColumns is GetRows that reads only the given columns from the
+// files whose tables are projectable.
+func (t *filesTable) GetRowsWithColumns(columns []string) func() (map[string]Value, error) {
+	next, _ := t.getFileRows(nil, columns)
+	return next
+}
+
+// GetClosableRows is GetRows that also returns a function that closes the
+// file being read.
+func (t *filesTable) GetClosableRows() (func() (map[string]Value, error), func() error) {
+	return t.getFileRows(nil, nil)
+}
+
+// getFileRows is GetClosableRows that skips the files for which keep returns
+// false and reads only the given columns unless columns is nil.
+func (t *filesTable) getFileRows(keep func(path string) bool, columns []string) (func() (map[string]Value, error), func() error) {
+	paths := t.keptPaths(keep)
+	init := false
+	next, closeFile := t.readFiles(paths, columns)
+	read := func() (map[string]Value, error) {
+		if !init {
+			init = true
+			if err := t.mergeColumns(paths); err != nil {
+				return nil, err
+			}
+		}
+		return next()
+	}
+	return read, closeFile
+}
+
+// partitions returns a reader for each of the files for which keep returns
+// true, in the order of the files. The readers may be used on different
+// goroutines, but only after the stream has returned the first of them,
+// when the columns of all the files are merged. The readers read only the
+// given columns unless columns is nil.
+func (t *filesTable) partitions(keep func(path string) bool, columns []string) *Stream[partitionReader] {
+	paths := t.keptPaths(keep)
+	init := false
+	i := 0
+	return &Stream[partitionReader]{
+		"files",
+		func() (partitionReader, bool, error) {
+			if !init {
+				init = true
+				if err := t.mergeColumns(paths); err != nil {
+					return nil, false, err
+				}
+			}
+			if i >= len(paths) {
+				return nil, true, nil
+			}
+			path := paths[i]
+			i++
+			return func() (func() (map[string]Value, error), func() error) {
+				return t.readFiles([]string{path}, columns)
+			}, false, nil
+		},
+		nil,
+	}
+}
+
+// keptPaths returns the table's paths for which keep returns true.
+func (t *filesTable) keptPaths(keep func(path string) bool) []string {
+	var paths []string
+	for _, p := range t.paths {
+		if keep == nil || keep(p) {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// readFiles returns the function that reads the rows of the files one
+// after another and the function that closes the file being read. The
+// files' columns must be merged into the table's columns beforehand. Unless
+// columns is nil, only the given columns are read from the files whose
+// tables are projectable and not closable, and the rows have only those
+// columns.
+func (t *filesTable) readFiles(paths []string, columns []string) (func() (map[string]Value, error), func() error) {
+	var keep map[string]bool
+	if columns != nil {
+		keep = columnNames(columns)
+	}
+	i := -1
+	var file *os.File
+	var table Table
+	var next func() (map[string]Value, error)
+	var closeNext func() error
+
+	// closeFile releases the current file and the table reading it.
+	closeFile := func() error {
+		next = nil
+		if file == nil {
+			return nil
+		}
+		var err error
+		if closeNext != nil {
+			err = closeNext()
+			closeNext = nil
+		}
+		if err2 := file.Close(); err == nil {
+			err = err2
+		}
+		file = nil
+		return err
+	}
+
+	read := func() (map[string]Value, error) {
+		for {
+			if next == nil {
+				i++
+				if i >= len(paths) {
+					return nil, nil
+				}
+				var err error
+				file, err = os.Open(paths[i])
+				if err != nil {
+					return nil, err
+				}
+				table = t.open(paths[i], Decompress(file, paths[i]))
+				if ct, ok := table.(ClosableTable); ok {
+					next, closeNext = ct.GetClosableRows()
+				} else if pt, ok := table.(ProjectableTable); ok && columns != nil {
+					next = pt.GetRowsWithColumns(columns)
+				} else {
+					next = table.GetRows()
+				}
+			}
+			row, err := next()
+			if err != nil {
+				closeFile()
+				return nil, fmt.Errorf("%s: %w", paths[i], err)
+			}
+			if row == nil {
+				if err := closeFile(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return t.convert(row, paths[i], table, keep)
+		}
+	}
+	return read, closeFile
+}
+
+// mergeColumns reads the columns of the files and merges them into the
+// table's columns, so that rows of all files have the same columns. Files
+// whose columns are already merged are not opened again.
+func (t *filesTable) mergeColumns(paths []string) error {
+	for _, p := range paths {
+		if t.merged[p] {
+			continue
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		table := t.open(p, Decompress(f, p))
+		columns, err := table.Columns()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		if pt, ok := table.(interface{ partialColumns() bool }); ok && pt.partialColumns() {
+			t.partial = true
+		}
+		for _, c := range columns {
+			t.columns.merge(c)
+		}
+		t.merged[p] = true
+	}
+	return nil
+}
+
+// convert brings a file's row to the merged columns, or to those of them
+// that are in keep if it is not nil.
+func (t *filesTable) convert(row map[string]Value, path string, table Table, keep map[string]bool) (map[string]Value, error) {
+	r := map[string]Value{}
+	for _, c := range t.columns.columns {
+		if keep != nil && !keep[strings.ToLower(c.Name)] {
+			continue
+		}
+		v, ok := row[c.Name]
+		if !ok || v.Data == nil {
+			r[c.Name] = Value{c.Type, nil}
+			continue
+		}
+		cv, err := v.cast(c.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: column %s: %w", path, c.Name, err)
+		}
+		r[c.Name] = cv
+	}
+	r["_file"] = Value{String, path}
+	r["_line"] = Value{Int, nil}
+	if p, ok := table.(interface{ position() int }); ok && p.position() > 0 {
+		r["_line"] = Value{Int, p.position()}
+	}
+	return r, nil
+}
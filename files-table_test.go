@@ -0,0 +1,174 @@
+package sql
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilesTable(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"events-1.ndjson": "{\"id\": 1, \"v\": 1}\n{\"id\": 2, \"v\": 2}\n",
+		"events-2.ndjson": "{\"id\": 3, \"v\": 2.5, \"extra\": \"x\"}\n",
+		"other.ndjson":    "{\"id\": 4}\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opened := map[string]bool{}
+	open := func(path string, r io.Reader) Table {
+		opened[filepath.Base(path)] = true
+		return JsonStream(r, JsonOptions{})
+	}
+	table, err := FilesTable(filepath.Join(dir, "events-*.ndjson"), open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := New(map[string]Table{"t": table})
+
+	r, err := engine.ExecString(`select id, v, extra, _line from t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]any{
+		{`"id"`: 1, `"v"`: 1.0, `"extra"`: nil, `"_line"`: 1},
+		{`"id"`: 2, `"v"`: 2.0, `"extra"`: nil, `"_line"`: 2},
+		{`"id"`: 3, `"v"`: 2.5, `"extra"`: "x", `"_line"`: 1},
+	}
+	if diff := cmp.Diff(rowsAsJSON(r), want); diff != "" {
+		t.Fatalf("%s", diff)
+	}
+
+	opened = map[string]bool{}
+	target := filepath.Join(dir, "events-2.ndjson")
+	s, err := engine.Prepare(`select id from t where _file = ?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = s.Exec(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(rowsAsJSON(r), []map[string]any{{`"id"`: 3}}); diff != "" {
+		t.Fatalf("%s", diff)
+	}
+	if diff := cmp.Diff(map[string]bool{"events-2.ndjson": true}, opened); diff != "" {
+		t.Fatalf("%s", diff)
+	}
+
+	// A new table doesn't open the skipped files to get their columns.
+	opened = map[string]bool{}
+	table, err = FilesTable(filepath.Join(dir, "events-*.ndjson"), open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = New(map[string]Table{"t": table}).ExecString(`select id, extra from t where _file = '` + target + `'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(rowsAsJSON(r), []map[string]any{{`"id"`: 3, `"extra"`: "x"}}); diff != "" {
+		t.Fatalf("%s", diff)
+	}
+	if diff := cmp.Diff(map[string]bool{"events-2.ndjson": true}, opened); diff != "" {
+		t.Fatalf("%s", diff)
+	}
+
+	r, err = New(map[string]Table{"t": table}).ExecString(`describe t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 5 {
+		t.Errorf("got %d columns, want 5", len(r))
+	}
+}
+
+func TestFilesTableJoin(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a/1.ndjson", "b/1.ndjson"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		data := "{\"x\": 1}\n"
+		if name[0] == 'b' {
+			data = "{\"y\": 2}\n"
+		}
+		if err := os.WriteFile(path, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	open := func(path string, r io.Reader) Table {
+		return JsonStream(r, JsonOptions{})
+	}
+	tables := map[string]Table{}
+	for _, name := range []string{"a", "b"} {
+		table, err := FilesTable(filepath.Join(dir, name), open)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tables[name] = table
+	}
+	engine := New(tables)
+
+	// The unqualified _file is a's, so b's files must not be skipped.
+	s, err := engine.Prepare(`select x, y from a join b on true where _file = ?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.Exec(filepath.Join(dir, "a/1.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]map[string]any{{`"x"`: 1, `"y"`: 2}}, rowsAsJSON(r)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFilesTableProjection(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"1", "2"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, workers := range []int{1, 2} {
+		var mu sync.Mutex
+		var asked []*[]string
+		open := func(path string, r io.Reader) Table {
+			mu.Lock()
+			defer mu.Unlock()
+			columns := new([]string)
+			asked = append(asked, columns)
+			return keyedTable{values: map[string]int{filepath.Base(path): 1}, columns: columns}
+		}
+		table, err := FilesTable(dir, open)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := New(map[string]Table{"f": table}).WithWorkers(workers).ExecString(`select v from f`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]map[string]any{{`"v"`: 1}, {`"v"`: 1}}, rowsAsJSON(r)); diff != "" {
+			t.Error(diff)
+		}
+		// The files are opened once for their columns and once for the rows.
+		var read [][]string
+		for _, columns := range asked {
+			if *columns != nil {
+				read = append(read, *columns)
+			}
+		}
+		if diff := cmp.Diff([][]string{{"v"}, {"v"}}, read); diff != "" {
+			t.Errorf("%d workers: %s", workers, diff)
+		}
+	}
+}
@@ -7,6 +7,18 @@ import (
 
 // Alphabetical list of functions http://dev.cs.ovgu.de/db/sybase9/help/dbrfen9/00000123.htm
 
+// builtinFunctions maps the built-in functions to their accepted signatures.
+// Cast is checked separately.
+var builtinFunctions = map[string][]Signature{
+	"array_contains": {{Args: []ValueTypeID{Array, Any}, Result: Bool}},
+	"cardinality":    {{Args: []ValueTypeID{Array}, Result: Int}},
+	"cast":           nil,
+	"substring": {
+		{Args: []ValueTypeID{String, Int}, Result: String},
+		{Args: []ValueTypeID{String, Int, Int}, Result: String},
+	},
+}
+
 func function(name string, args []Value) (Value, error) {
 	switch strings.ToLower(name) {
 	// array_contains(array, item)
@@ -14,6 +26,9 @@ func function(name string, args []Value) (Value, error) {
 		if len(args) != 2 {
 			return Value{}, fmt.Errorf("the %s function expects 2 arguments", strings.ToUpper(name))
 		}
+		if null, err := checkArgTypes(name, args, Array, Any); err != nil || null {
+			return Value{Bool, nil}, err
+		}
 		array := args[0]
 		item := args[1]
 		for _, x := range array.Data.([]Value) {
@@ -32,6 +47,9 @@ func function(name string, args []Value) (Value, error) {
 		if len(args) != 1 {
 			return Value{}, fmt.Errorf("the %s function expects 1 argument", strings.ToUpper(name))
 		}
+		if null, err := checkArgTypes(name, args, Array); err != nil || null {
+			return Value{Int, nil}, err
+		}
 		array := args[0]
 		return Value{Int, len(array.Data.([]Value))}, nil
 
@@ -41,11 +59,18 @@ func function(name string, args []Value) (Value, error) {
 		if len(args) != 2 && len(args) != 3 {
 			return Value{}, fmt.Errorf("the %s function expects 2 or 3 arguments", strings.ToUpper(name))
 		}
+		if null, err := checkArgTypes(name, args, String, Int, Int); err != nil || null {
+			return Value{String, nil}, err
+		}
 		value := []rune(args[0].Data.(string))
 		norm := func(x int) (int, error) {
 			switch true {
+			case x > len(value):
+				return len(value), nil
 			case x > 0:
 				return x - 1, nil
+			case x < -len(value):
+				return 0, nil
 			case x < 0:
 				return x + len(value), nil
 			default:
@@ -72,11 +97,32 @@ func function(name string, args []Value) (Value, error) {
 			if length < start {
 				length, start = start, length
 			}
+			if length >= len(value) {
+				length = len(value) - 1
+			}
 			return Value{String, string(value[start : length+1])}, nil
-		default:
-			panic("broken switch")
 		}
+		return Value{}, fmt.Errorf("the %s function expects 2 or 3 arguments", strings.ToUpper(name))
 	default:
 		return Value{}, fmt.Errorf("unknown function %s", name)
 	}
 }
+
+// checkArgTypes returns an error if the arguments don't have the given types
+// and tells whether any of them is null.
+func checkArgTypes(name string, args []Value, types ...ValueTypeID) (bool, error) {
+	null := false
+	for i, arg := range args {
+		if i >= len(types) {
+			break
+		}
+		if arg.Data == nil {
+			null = true
+			continue
+		}
+		if types[i] != Any && arg.Type != types[i] {
+			return false, fmt.Errorf("the %s function expects %s as argument %d, got %s", strings.ToUpper(name), getTypeName(types[i]), i+1, getTypeName(arg.Type))
+		}
+	}
+	return null, nil
+}
@@ -2,26 +2,98 @@ package sql
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"reflect"
+	"sort"
+	"strings"
+	"sync"
 )
 
+// JsonOptions configures a JSON table source.
+type JsonOptions struct {
+	// SampleSize is the number of rows used to infer the schema, 100 by
+	// default. Keys that first appear after the sample are added to the
+	// schema when they are met. After the sample, Int columns still widen
+	// to Double, but other values that don't fit their column's type are
+	// bad rows handled according to OnError.
+	SampleSize int
+
+	// Schema, if set, is used instead of the inferred one.
+	Schema *Schema
+
+	// OnError tells what to do with rows that can't be read. With policies
+	// other than FailOnError, reading resumes after a malformed record at
+	// the next line that starts with an object.
+	OnError ErrorPolicy
+
+	// ErrorCallback, if set, is called for every bad row.
+	ErrorCallback func(*RowError)
+
+	// RecordPath, if set, points to the array of records inside the input,
+	// for example $.data.items[*]. The path is a chain of object keys
+	// ending with [*].
+	RecordPath string
+
+	// FlattenDepth, if positive, turns nested objects up to this depth into
+	// separate columns named by their paths, like request.headers.host.
+	// Deeper objects stay JSON values and arrays stay Array values.
+	FlattenDepth int
+}
+
 type jsonStream struct {
-	_init    bool
-	dec      *json.Decoder
-	schema   map[string]ValueTypeID
-	firstRow map[string]Value
+	rowErrors
+	_init   bool
+	opts    JsonOptions
+	dec     *json.Decoder
+	br      *bufio.Reader
+	counter *lineCounter
+	started bool
+	inArray bool
+	done    bool
+	columns *columnSet
+	sample  []jsonObject
+	n       int
+
+	// base is the offset in the input of the decoder's first byte. The
+	// decoder is replaced after a malformed record, which it can't read
+	// past, see resync.
+	base   int64
+	broken bool
+
+	// pending are the bytes of the input that the broken decoder has read
+	// ahead, and offset is the offset of the first of them.
+	pending []byte
+	offset  int64
+
+	// sampledAll is set if the sample has all the rows.
+	sampledAll bool
+	last       int
+
+	// mu guards the row errors when chunks of the stream are read in
+	// parallel.
+	mu sync.Mutex
 }
 
-func JsonStream(r io.Reader) *jsonStream {
-	br := bufio.NewReader(r)
-	dec := json.NewDecoder(br)
-	return &jsonStream{
-		dec: dec,
+// JsonStream returns a table that reads a stream of JSON objects from the
+// reader. Compressed data has to be decompressed by the caller, see
+// Decompress.
+func JsonStream(r io.Reader, opts JsonOptions) *jsonStream {
+	if opts.SampleSize <= 0 {
+		opts.SampleSize = 100
 	}
+	s := &jsonStream{
+		rowErrors: rowErrors{policy: opts.OnError, callback: opts.ErrorCallback},
+		opts:      opts,
+		counter:   &lineCounter{r: r},
+	}
+	s.br = bufio.NewReader(s.counter)
+	s.dec = json.NewDecoder(s.br)
+	s.dec.UseNumber()
+	return s
 }
 
 func (s *jsonStream) init() error {
@@ -29,95 +101,792 @@ func (s *jsonStream) init() error {
 		return nil
 	}
 	s._init = true
+	s.columns = &columnSet{}
+	if s.opts.Schema != nil {
+		return nil
+	}
+
+	// Read a sample of rows and infer the schema from it.
+	for len(s.sample) < s.opts.SampleSize {
+		obj, err := s.decode()
+		if err == io.EOF {
+			s.sampledAll = true
+			break
+		}
+		if err != nil {
+			if err := s.reject(err); err != nil {
+				return err
+			}
+			continue
+		}
+		s.sample = append(s.sample, obj)
+	}
+	for _, obj := range s.sample {
+		s.columns.addObject(obj)
+	}
+	return nil
+}
+
+// partialColumns tells whether rows after the sample may have columns that
+// Columns doesn't list.
+func (s *jsonStream) partialColumns() bool {
+	return s.opts.Schema == nil && !s.sampledAll
+}
+
+// reject applies the error policy to a bad row error.
+func (s *jsonStream) reject(err error) error {
+	re, ok := err.(*RowError)
+	if !ok {
+		return err
+	}
+	return s.handle(re)
+}
+
+// decode reads the next object from the input.
+func (s *jsonStream) decode() (jsonObject, error) {
+	r, err := s.readRecord()
+	if err != nil {
+		return jsonObject{}, err
+	}
+	return r.decode(s.opts.FlattenDepth)
+}
+
+// nextRecord moves the decoder to the next record. It returns io.EOF if
+// there are no more records.
+func (s *jsonStream) nextRecord() error {
+	if !s.started {
+		s.started = true
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	if s.inArray && !s.dec.More() {
+		s.inArray = false
+		s.done = true
+		if _, err := s.dec.Token(); err != nil {
+			return err
+		}
+	}
+	if s.done {
+		return io.EOF
+	}
+	return nil
+}
 
-	// Read one row as map.
-	var m map[string]any
-	err := s.dec.Decode(&m)
+// jsonRecord is the raw data of a record that is read but not decoded yet.
+type jsonRecord struct {
+	data      []byte
+	row, line int
+}
 
-	// If the data source is empty, treat it as an empty table.
+// readRecord reads the next record without decoding it. A malformed record
+// is returned as a row error, and the next call resumes reading after it.
+func (s *jsonStream) readRecord() (jsonRecord, error) {
+	if s.broken {
+		if err := s.resync(); err != nil {
+			return jsonRecord{}, err
+		}
+	}
+	if err := s.nextRecord(); err != nil {
+		return jsonRecord{}, err
+	}
+	var raw json.RawMessage
+	err := s.dec.Decode(&raw)
 	if err == io.EOF {
-		s.schema = map[string]ValueTypeID{}
+		return jsonRecord{}, err
+	}
+	s.n++
+	if err != nil {
+		return jsonRecord{}, s.malformed(err)
+	}
+	line := s.counter.lineAt(s.base + s.dec.InputOffset() - int64(len(raw)))
+	return jsonRecord{data: raw, row: s.n, line: line}, nil
+}
+
+// malformed returns the row error for a record that the decoder failed to
+// read. The error has the first line of the record, which is skipped along
+// with the decoder.
+func (s *jsonStream) malformed(err error) error {
+	var syntax *json.SyntaxError
+	if !errors.As(err, &syntax) && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	s.broken = true
+	s.pending, _ = io.ReadAll(s.dec.Buffered())
+	s.offset = s.base + s.dec.InputOffset()
+	var text []byte
+	start := int64(-1)
+	for {
+		b, err := s.readByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if start < 0 && (isBlank(b) || b == '\n') {
+			continue
+		}
+		if start < 0 {
+			start = s.offset - 1
+		}
+		if b == '\n' {
+			break
+		}
+		text = append(text, b)
+	}
+	if start < 0 {
+		start = s.offset
+	}
+	line := s.counter.lineAt(start)
+	return &RowError{s.n, line, strings.TrimRight(string(text), "\r"), err}
+}
+
+// resync replaces the broken decoder with one that starts at the next line
+// beginning with an object or, inside an array of records, with the end of
+// the array.
+func (s *jsonStream) resync() error {
+	s.broken = false
+	lineStart := true
+	for {
+		b, err := s.readByte()
+		if err == io.EOF {
+			s.inArray = false
+			s.done = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case b == '\n':
+			lineStart = true
+			continue
+		case isBlank(b) || !lineStart:
+			continue
+		case b == '{' || b == ']' && s.inArray:
+		default:
+			lineStart = false
+			continue
+		}
+		// The new decoder is put inside the array of records, if any.
+		prefix := string(b)
+		if s.inArray {
+			prefix = "[" + prefix
+		}
+		s.base = s.offset - int64(len(prefix))
+		s.dec = json.NewDecoder(io.MultiReader(strings.NewReader(prefix), bytes.NewReader(s.pending), s.br))
+		s.dec.UseNumber()
+		s.pending = nil
+		if s.inArray {
+			_, err := s.dec.Token()
+			return err
+		}
 		return nil
 	}
+}
 
-	// Infer types from the first row.
-	schema := map[string]ValueTypeID{}
-	for k, v := range m {
-		schema[k] = guessType(v)
+// readByte reads the next byte of the input after a malformed record.
+func (s *jsonStream) readByte() (byte, error) {
+	if len(s.pending) > 0 {
+		b := s.pending[0]
+		s.pending = s.pending[1:]
+		s.offset++
+		return b, nil
+	}
+	b, err := s.br.ReadByte()
+	if err == nil {
+		s.offset++
 	}
-	s.schema = schema
+	return b, err
+}
 
-	// Stash the first row for reuse.
-	s.firstRow = s.parse(m)
-	return nil
+// isBlank tells whether the byte is JSON whitespace other than a newline.
+func isBlank(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r'
 }
 
-func (s *jsonStream) ColumnNames() []string {
-	if err := s.init(); err != nil {
-		panic(err)
+// decode decodes the record as a JSON object.
+func (r jsonRecord) decode(depth int) (jsonObject, error) {
+	dec := json.NewDecoder(bytes.NewReader(r.data))
+	dec.UseNumber()
+	obj, err := decodeObject(dec, depth)
+	obj.row, obj.line, obj.data = r.row, r.line, r.data
+	if err != nil {
+		return obj, &RowError{r.row, r.line, string(r.data), err}
 	}
-	var r []string
-	for k := range s.schema {
-		r = append(r, k)
+	return obj, nil
+}
+
+// jsonChunkSize is the number of records in a chunk of a JSON stream.
+const jsonChunkSize = 1024
+
+// chunks returns readers of consecutive chunks of the stream, which may be
+// used on different goroutines. The stream only splits the input into
+// records, and the readers decode and convert them. The stream must have a
+// schema, as the columns inferred while reading depend on the order of the
+// rows. Bad rows are handled in the order the readers meet them.
+func (s *jsonStream) chunks(keep map[string]bool) *Stream[partitionReader] {
+	return &Stream[partitionReader]{
+		"json chunks",
+		func() (partitionReader, bool, error) {
+			if err := s.init(); err != nil {
+				return nil, false, err
+			}
+			var records []jsonRecord
+			for len(records) < jsonChunkSize {
+				r, err := s.readRecord()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					if err := s.rejectShared(err); err != nil {
+						return nil, false, err
+					}
+					continue
+				}
+				records = append(records, r)
+			}
+			if len(records) == 0 {
+				return nil, true, nil
+			}
+			return func() (func() (map[string]Value, error), func() error) {
+				return s.readChunk(records, keep), nil
+			}, false, nil
+		},
+		nil,
 	}
-	return r
 }
 
-func (s *jsonStream) read() (map[string]Value, error) {
-	// read one line, parse as map
-	var m map[string]any
-	err := s.dec.Decode(&m)
-	if err == io.EOF {
+// readChunk returns the function that returns the rows of the records.
+func (s *jsonStream) readChunk(records []jsonRecord, keep map[string]bool) func() (map[string]Value, error) {
+	return func() (map[string]Value, error) {
+		for len(records) > 0 {
+			r := records[0]
+			records = records[1:]
+			obj, err := r.decode(s.opts.FlattenDepth)
+			if err == nil {
+				var row map[string]Value
+				row, err = s.parse(obj, keep)
+				if err == nil {
+					return row, nil
+				}
+				err = &RowError{r.row, r.line, string(r.data), err}
+			}
+			if err := s.rejectShared(err); err != nil {
+				return nil, err
+			}
+		}
 		return nil, nil
 	}
+}
+
+// rejectShared is reject for the readers of chunks, which may run at the
+// same time.
+func (s *jsonStream) rejectShared(err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reject(err)
+}
+
+// start positions the decoder before the first record. The elements of a
+// top-level array or of the array at the record path are read as records.
+func (s *jsonStream) start() error {
+	if s.opts.RecordPath == "" {
+		for i := 1; ; i++ {
+			b, err := s.br.Peek(i)
+			if err != nil {
+				// Let the decoder deal with empty or broken input.
+				return nil
+			}
+			switch b[i-1] {
+			case ' ', '\t', '\r', '\n':
+				continue
+			case '[':
+				s.inArray = true
+				_, err := s.dec.Token()
+				return err
+			default:
+				return nil
+			}
+		}
+	}
+	keys, err := parseRecordPath(s.opts.RecordPath)
 	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := findKey(s.dec, key); err != nil {
+			return fmt.Errorf("%s: %w", s.opts.RecordPath, err)
+		}
+	}
+	t, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != json.Delim('[') {
+		return fmt.Errorf("%s: expected an array, got %v", s.opts.RecordPath, t)
+	}
+	s.inArray = true
+	return nil
+}
+
+// parseRecordPath returns the keys of a record path like $.data.items[*].
+func parseRecordPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "$") || !strings.HasSuffix(path, "[*]") {
+		return nil, fmt.Errorf("invalid record path %s: expected $.key.key[*]", path)
+	}
+	rest := path[1 : len(path)-3]
+	if rest == "" {
+		return nil, nil
+	}
+	if rest[0] != '.' {
+		return nil, fmt.Errorf("invalid record path %s: expected $.key.key[*]", path)
+	}
+	keys := strings.Split(rest[1:], ".")
+	for _, k := range keys {
+		if k == "" {
+			return nil, fmt.Errorf("invalid record path %s: empty key", path)
+		}
+	}
+	return keys, nil
+}
+
+// findKey reads an object up to the value of the given key, skipping the
+// values of other keys.
+func findKey(dec *json.Decoder, key string) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != json.Delim('{') {
+		return fmt.Errorf("expected an object with key %s, got %v", key, t)
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if t == key {
+			return nil
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("key %s not found", key)
+}
+
+// parse converts the object to a row. If keep is not nil, only the columns
+// in it are converted.
+func (s *jsonStream) parse(obj jsonObject, keep map[string]bool) (map[string]Value, error) {
+	if s.opts.Schema != nil {
+		return parseJsonRowWithSchema(s.opts.Schema, obj)
+	}
+	if keep == nil {
+		return parseJsonRow(s.columns.columns, obj)
+	}
+	var columns []Column
+	for _, c := range s.columns.columns {
+		if keep[strings.ToLower(c.Name)] {
+			columns = append(columns, c)
+		}
+	}
+	return parseJsonRow(columns, obj)
+}
+
+// Columns returns the declared columns or the ones inferred so far.
+func (s *jsonStream) Columns() ([]Column, error) {
+	if s.opts.Schema != nil {
+		return s.opts.Schema.Columns, nil
+	}
+	if err := s.init(); err != nil {
 		return nil, err
 	}
-	return s.parse(m), nil
+	return s.columns.columns, nil
 }
 
-func (s *jsonStream) parse(m map[string]any) map[string]Value {
-	row := map[string]Value{}
-	for k, t := range s.schema {
-		row[k] = Value{t, m[k]}
+func (s *jsonStream) read() (jsonObject, error) {
+	if len(s.sample) > 0 {
+		obj := s.sample[0]
+		s.sample = s.sample[1:]
+		return obj, nil
+	}
+	obj, err := s.decode()
+	if err != nil {
+		return obj, err
 	}
-	return row
+	// Add the keys that didn't appear in the sample.
+	if s.opts.Schema == nil {
+		s.columns.addNew(obj)
+	}
+	return obj, nil
 }
 
 func (s *jsonStream) GetRows() func() (map[string]Value, error) {
-	first := true
+	return s.getRows(nil)
+}
+
+// GetRowsWithColumns is GetRows that skips converting the values of the
+// other columns.
+func (s *jsonStream) GetRowsWithColumns(columns []string) func() (map[string]Value, error) {
+	return s.getRows(columnNames(columns))
+}
+
+func (s *jsonStream) getRows(keep map[string]bool) func() (map[string]Value, error) {
 	return func() (map[string]Value, error) {
 		if err := s.init(); err != nil {
 			return nil, err
 		}
-		if first {
-			first = false
-			return s.firstRow, nil
+		for {
+			obj, err := s.read()
+			if err == io.EOF {
+				return nil, nil
+			}
+			if err != nil {
+				if err := s.reject(err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			row, err := s.parse(obj, keep)
+			if err != nil {
+				if err := s.handle(&RowError{obj.row, obj.line, string(obj.data), err}); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			s.last = obj.line
+			return row, nil
+		}
+	}
+}
+
+// position returns the line of the last returned row.
+func (s *jsonStream) position() int {
+	return s.last
+}
+
+// jsonObject is a decoded JSON object that remembers the order of its keys
+// and where it came from.
+type jsonObject struct {
+	keys   []string
+	values map[string]any
+	row    int
+	line   int
+
+	// data is the raw data of the record.
+	data []byte
+}
+
+// decodeObject reads one JSON object from the decoder.
+// Returns io.EOF if there are no more values. Nested objects are flattened
+// up to the given depth.
+func decodeObject(dec *json.Decoder, depth int) (jsonObject, error) {
+	obj := jsonObject{values: map[string]any{}}
+	t, err := dec.Token()
+	if err != nil {
+		return obj, err
+	}
+	if t != json.Delim('{') {
+		return obj, fmt.Errorf("expected an object, got %v", t)
+	}
+	set := func(key string, v any) {
+		if _, ok := obj.values[key]; !ok {
+			obj.keys = append(obj.keys, key)
+		}
+		obj.values[key] = v
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return obj, err
+		}
+		key := t.(string)
+		if depth <= 0 {
+			var v any
+			if err := dec.Decode(&v); err != nil {
+				return obj, err
+			}
+			set(key, v)
+			continue
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return obj, err
+		}
+		sub := json.NewDecoder(bytes.NewReader(raw))
+		sub.UseNumber()
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+			nested, err := decodeObject(sub, depth-1)
+			if err != nil {
+				return obj, err
+			}
+			for _, k := range nested.keys {
+				set(key+"."+k, nested.values[k])
+			}
+			continue
+		}
+		var v any
+		if err := sub.Decode(&v); err != nil {
+			return obj, err
+		}
+		set(key, v)
+	}
+	if _, err := dec.Token(); err != nil {
+		return obj, err
+	}
+	return obj, nil
+}
+
+// lineCounter is a reader that tracks line numbers of the data passing
+// through it.
+type lineCounter struct {
+	r        io.Reader
+	pos      int64
+	newlines []int64
+	lines    int
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			c.newlines = append(c.newlines, c.pos+int64(i))
+		}
+	}
+	c.pos += int64(n)
+	return n, err
+}
+
+// lineAt returns the line number at the given offset. Offsets must not
+// decrease between calls.
+func (c *lineCounter) lineAt(offset int64) int {
+	for len(c.newlines) > 0 && c.newlines[0] < offset {
+		c.lines++
+		c.newlines = c.newlines[1:]
+	}
+	return c.lines + 1
+}
+
+// columnSet is an inferred schema that keeps columns in the order their keys
+// were first met.
+type columnSet struct {
+	columns []Column
+	index   map[string]int
+}
+
+// addObject adds the object's keys, widening the types of known columns.
+func (c *columnSet) addObject(obj jsonObject) {
+	for _, k := range obj.keys {
+		t := guessType(obj.values[k])
+		i, ok := c.find(k)
+		if !ok {
+			c.add(k, t)
+			continue
+		}
+		c.columns[i].Type = widenType(c.columns[i].Type, t)
+	}
+}
+
+// addNew adds the object's keys that are not known yet. The types of known
+// columns are not changed, except that Int columns widen to Double, which
+// the values read before still compare with.
+func (c *columnSet) addNew(obj jsonObject) {
+	for _, k := range obj.keys {
+		t := guessType(obj.values[k])
+		i, ok := c.find(k)
+		switch {
+		case !ok:
+			c.add(k, t)
+		case c.columns[i].Type == undefined:
+			c.columns[i].Type = t
+		case c.columns[i].Type == Int && t == Double:
+			c.merge(Column{k, t, true})
+		}
+	}
+}
+
+// merge adds a column, widening the type of a known column with the same
+// name.
+func (c *columnSet) merge(col Column) {
+	i, ok := c.find(col.Name)
+	if !ok {
+		c.add(col.Name, col.Type)
+		return
+	}
+	if t := widenType(c.columns[i].Type, col.Type); t != c.columns[i].Type {
+		c.columns = append([]Column{}, c.columns...)
+		c.columns[i].Type = t
+	}
+}
+
+func (c *columnSet) find(name string) (int, bool) {
+	i, ok := c.index[name]
+	return i, ok
+}
+
+func (c *columnSet) add(name string, t ValueTypeID) {
+	if c.index == nil {
+		c.index = map[string]int{}
+	}
+	c.index[name] = len(c.columns)
+	// Copy the slice so that the columns returned earlier don't change.
+	c.columns = append(c.columns[:len(c.columns):len(c.columns)], Column{name, t, true})
+}
+
+// parseJsonRow converts a decoded JSON object to a row with the given columns.
+func parseJsonRow(columns []Column, obj jsonObject) (map[string]Value, error) {
+	row := map[string]Value{}
+	for _, c := range columns {
+		v, err := fromJSON(obj.values[c.Name], c.Type)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", c.Name, err)
 		}
-		return s.read()
+		row[c.Name] = v
 	}
+	return row, nil
 }
 
-func castToInt(item map[string]any) {
-	for k, v := range item {
-		if f, ok := v.(float64); ok && float64(int(f)) == f {
-			item[k] = int(f)
+func parseJsonRowWithSchema(schema *Schema, obj jsonObject) (map[string]Value, error) {
+	values := map[string]Value{}
+	for k, x := range obj.values {
+		v, err := fromJSON(x, guessType(x))
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", k, err)
 		}
+		values[k] = v
 	}
+	return schema.coerce(values)
 }
 
+// guessType returns the type of a value decoded from JSON.
+// Null values have undefined type.
 func guessType(x any) ValueTypeID {
-	switch x.(type) {
+	switch v := x.(type) {
+	case nil:
+		return undefined
+	case bool:
+		return Bool
 	case string:
 		return String
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return Int
+		}
+		return Double
 	case float64:
 		return Double
 	case int:
 		return Int
-	case []interface{}:
+	case []any:
 		return Array
 	default:
-		panic(fmt.Errorf("unexpected value type: %s", reflect.TypeOf(x)))
+		return JSON
+	}
+}
+
+// widenType returns a type that can hold values of both given types.
+// Ints widen to Doubles, numbers widen to Strings, and all other mixes
+// widen to JSON.
+func widenType(t1, t2 ValueTypeID) ValueTypeID {
+	switch {
+	case t1 == undefined:
+		return t2
+	case t2 == undefined, t1 == t2:
+		return t1
+	}
+	number := func(t ValueTypeID) bool {
+		return t == Int || t == Double
+	}
+	switch {
+	case number(t1) && number(t2):
+		return Double
+	case number(t1) && t2 == String, t1 == String && number(t2):
+		return String
+	default:
+		return JSON
+	}
+}
+
+// fromJSON converts a value decoded from JSON to a value of the given type.
+func fromJSON(x any, t ValueTypeID) (Value, error) {
+	if x == nil {
+		return Value{t, nil}, nil
+	}
+	switch t {
+	case JSON:
+		return Value{JSON, plainJSON(x)}, nil
+	case Array:
+		items, ok := x.([]any)
+		if !ok {
+			break
+		}
+		r := make([]Value, len(items))
+		for i, item := range items {
+			v, err := fromJSON(item, guessType(item))
+			if err != nil {
+				return Value{}, err
+			}
+			r[i] = v
+		}
+		return Value{Array, r}, nil
+	case String:
+		switch v := x.(type) {
+		case string:
+			return Value{String, v}, nil
+		case json.Number:
+			return Value{String, v.String()}, nil
+		}
+	case Double:
+		if n, ok := x.(json.Number); ok {
+			f, err := n.Float64()
+			if err != nil {
+				return Value{}, err
+			}
+			return Value{Double, f}, nil
+		}
+	case Int:
+		if n, ok := x.(json.Number); ok {
+			i, err := n.Int64()
+			if err != nil {
+				return Value{}, fmt.Errorf("can't read %s as Int", n)
+			}
+			return Value{Int, int(i)}, nil
+		}
+	case Bool:
+		if b, ok := x.(bool); ok {
+			return Value{Bool, b}, nil
+		}
+	}
+	return Value{}, fmt.Errorf("can't read %s value as %s", getTypeName(guessType(x)), getTypeName(t))
+}
+
+// plainJSON replaces json.Numbers in a decoded JSON value with ints and
+// float64s.
+func plainJSON(x any) any {
+	switch v := x.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case []any:
+		r := make([]any, len(v))
+		for i, item := range v {
+			r[i] = plainJSON(item)
+		}
+		return r
+	case map[string]any:
+		r := map[string]any{}
+		for k, item := range v {
+			r[k] = plainJSON(item)
+		}
+		return r
+	default:
+		return x
 	}
 }
 
@@ -135,58 +904,82 @@ func (data dummy) GetRows() func() (map[string]Value, error) {
 	}
 }
 
-func (data dummy) ColumnNames() []string {
-	var s []string
-	for k := range data[0] {
-		s = append(s, k)
+// Columns returns the columns of the first row sorted by name.
+func (data dummy) Columns() ([]Column, error) {
+	var r []Column
+	if len(data) == 0 {
+		return r, nil
 	}
-	return s
+	for k, v := range data[0] {
+		r = append(r, Column{k, v.Type, true})
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Name < r[j].Name
+	})
+	return r, nil
+}
+
+// memTable is a table held in memory.
+type memTable struct {
+	columns []Column
+	rows    dummy
+}
+
+func (t *memTable) GetRows() func() (map[string]Value, error) {
+	return t.rows.GetRows()
 }
 
-func JsonTable(path string) dummy {
+func (t *memTable) Columns() ([]Column, error) {
+	return t.columns, nil
+}
+
+// JsonTable reads a JSON array of objects from the file into memory.
+// Unless a schema is given in the options, it is inferred from all the
+// objects.
+func JsonTable(path string, opts JsonOptions) (*memTable, error) {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		panic(err)
-	}
-	var items []map[string]any
-	err = json.Unmarshal(data, &items)
-	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	for _, item := range items {
-		castToInt(item)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+		return nil, fmt.Errorf("expected a JSON array in %s", path)
 	}
-
-	extend := func(t1, t2 ValueTypeID) ValueTypeID {
-		if t1 == undefined {
-			return t2
-		}
-		if t1 == t2 {
-			return t1
+	var items []jsonObject
+	for dec.More() {
+		obj, err := decodeObject(dec, opts.FlattenDepth)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", len(items)+1, err)
 		}
-		if t1 == Int && t2 == String {
-			return String
-		}
-		if t1 == String && t2 == Int {
-			return String
-		}
-		panic(fmt.Errorf("extend %s %s", getTypeName(t1), getTypeName(t2)))
+		items = append(items, obj)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
 	}
 
-	schema := map[string]ValueTypeID{}
-	for _, item := range items {
-		for k, v := range item {
-			schema[k] = extend(schema[k], guessType(v))
+	t := &memTable{}
+	if opts.Schema != nil {
+		t.columns = opts.Schema.Columns
+	} else {
+		cs := &columnSet{}
+		for _, item := range items {
+			cs.addObject(item)
 		}
+		t.columns = cs.columns
 	}
-
-	d := dummy{}
-	for _, item := range items {
-		row := map[string]Value{}
-		for k, t := range schema {
-			row[k] = Value{t, item[k]}
+	for i, item := range items {
+		var row map[string]Value
+		var err error
+		if opts.Schema != nil {
+			row, err = parseJsonRowWithSchema(opts.Schema, item)
+		} else {
+			row, err = parseJsonRow(t.columns, item)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
 		}
-		d = append(d, row)
+		t.rows = append(t.rows, row)
 	}
-	return d
+	return t, nil
 }
@@ -0,0 +1,191 @@
+package sql
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJsonStream(t *testing.T) {
+	cases := []struct {
+		name  string
+		data  string
+		opts  JsonOptions
+		query string
+		want  []map[string]any
+	}{
+		{
+			"key first appears on the second line",
+			`{"a": 1}
+			{"a": 2, "b": "x"}`,
+			JsonOptions{},
+			`select a, b from t`,
+			[]map[string]any{{`"a"`: 1, `"b"`: nil}, {`"a"`: 2, `"b"`: "x"}},
+		},
+		{
+			"int widens to double",
+			`{"a": 1} {"a": 1.5}`,
+			JsonOptions{},
+			`select a from t`,
+			[]map[string]any{{`"a"`: 1.0}, {`"a"`: 1.5}},
+		},
+		{
+			"number widens to string",
+			`{"a": 1} {"a": "x"}`,
+			JsonOptions{},
+			`select a from t`,
+			[]map[string]any{{`"a"`: "1"}, {`"a"`: "x"}},
+		},
+		{
+			"bools, nulls and objects",
+			`{"a": true, "b": null, "c": {"d": 1}}`,
+			JsonOptions{},
+			`select a, b, c from t`,
+			[]map[string]any{{`"a"`: true, `"b"`: nil, `"c"`: map[string]any{"d": 1}}},
+		},
+		{
+			"key after the sample window",
+			`{"a": 1} {"a": 2, "b": 3}`,
+			JsonOptions{SampleSize: 1},
+			`select b from t where a = 2`,
+			[]map[string]any{{`"b"`: 3}},
+		},
+		{
+			"key after the sample window selected with other keys",
+			`{"a": 1, "b": 1} {"a": 2, "c": 7}`,
+			JsonOptions{SampleSize: 1},
+			`select a, c from t`,
+			[]map[string]any{{`"a"`: 1, `"c"`: nil}, {`"a"`: 2, `"c"`: 7}},
+		},
+		{
+			"int widens to double after the sample window",
+			`{"a": 1} {"a": 2.5} {"a": 3}`,
+			JsonOptions{SampleSize: 1},
+			`select a from t where a > 2`,
+			[]map[string]any{{`"a"`: 2.5}, {`"a"`: 3.0}},
+		},
+		{
+			"string after the sample window in a skipped row",
+			`{"a": 1} {"a": "x"} {"a": 3}`,
+			JsonOptions{SampleSize: 1, OnError: SkipOnError},
+			`select a from t`,
+			[]map[string]any{{`"a"`: 1}, {`"a"`: 3}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			engine := New(map[string]Table{"t": JsonStream(strings.NewReader(c.data), c.opts)})
+			r, err := engine.ExecString(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(rowsAsJSON(r), c.want); diff != "" {
+				t.Fatalf("%s", diff)
+			}
+		})
+	}
+}
+
+func TestJsonStreamTypeConflict(t *testing.T) {
+	table := JsonStream(strings.NewReader("{\"a\": 1}\n{\"a\": \"x\"}"), JsonOptions{SampleSize: 1})
+	_, err := New(map[string]Table{"t": table}).ExecString(`select a from t`)
+	if err == nil {
+		t.Fatalf("expected an error, got nil")
+	}
+	if diff := cmp.Diff("line 2: column a: can't read String value as Int", err.Error()); diff != "" {
+		t.Fatalf("%s", diff)
+	}
+}
+
+func TestJsonStreamColumnOrder(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		table := JsonStream(strings.NewReader(`{"b": 1, "a": 2, "c": 3} {"d": 4, "b": 5}`), JsonOptions{})
+		r, err := New(map[string]Table{"t": table}).ExecString(`select * from t`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, c := range r[1] {
+			names = append(names, c.Name)
+		}
+		if diff := cmp.Diff([]string{"b", "a", "c", "d"}, names); diff != "" {
+			t.Fatalf("%s", diff)
+		}
+	}
+}
+
+func TestJsonStreamArrays(t *testing.T) {
+	f, err := os.Open("test-data.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cases := []struct {
+		name  string
+		data  io.Reader
+		opts  JsonOptions
+		query string
+		want  []map[string]any
+	}{
+		{
+			"top-level array",
+			f,
+			JsonOptions{},
+			`select name from cars where year < 2009`,
+			[]map[string]any{{`"name"`: "Cadillac SRX"}},
+		},
+		{
+			"record path",
+			strings.NewReader(`{"meta": {"items": [1]}, "data": {"total": 2, "items": [{"id": 1}, {"id": 2}]}, "more": 1}`),
+			JsonOptions{RecordPath: "$.data.items[*]"},
+			`select id from cars`,
+			[]map[string]any{{`"id"`: 1}, {`"id"`: 2}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			engine := New(map[string]Table{"cars": JsonStream(c.data, c.opts)})
+			r, err := engine.ExecString(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(rowsAsJSON(r), c.want); diff != "" {
+				t.Fatalf("%s", diff)
+			}
+		})
+	}
+}
+
+func TestJsonStreamFlatten(t *testing.T) {
+	data := `{"request": {"method": "GET", "headers": {"host": "a.com", "x": {"y": 1}}}, "tags": [1, 2]}`
+	cases := []struct {
+		depth int
+		query string
+		want  []map[string]any
+	}{
+		{2, `select "request.method" as m, request.headers.host as h, t.request.method as tm from t`, []map[string]any{
+			{"m": "GET", "h": "a.com", "tm": "GET"},
+		}},
+		{2, `select "request.headers.x" as x, cardinality(tags) as n from t`, []map[string]any{
+			{"x": map[string]any{"y": 1}, "n": 2},
+		}},
+		{1, `select "request.headers" as h from t`, []map[string]any{
+			{"h": map[string]any{"host": "a.com", "x": map[string]any{"y": 1}}},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			table := JsonStream(strings.NewReader(data), JsonOptions{FlattenDepth: c.depth})
+			r, err := New(map[string]Table{"t": table}).ExecString(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(rowsAsJSON(r), c.want); diff != "" {
+				t.Fatalf("%s", diff)
+			}
+		})
+	}
+}
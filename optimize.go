@@ -0,0 +1,542 @@
+package sql
+
+import (
+	"sort"
+	"strings"
+)
+
+// optimize rewrites the plan into one that produces the same rows with less
+// work: it folds constant expressions, moves filters below joins and into
+// the tables that can apply them, lets the scans of files tables skip the
+// files their filters exclude, drops the columns the query doesn't use
+// right at the scans, moves limits below projections, replaces sorts
+// followed by limits with top-N selection and spreads the scans of tables
+// that can be read in parts over the engine's workers.
+func (e Engine) optimize(n planNode) planNode {
+	n = e.foldConstants(n)
+	n = pushFilters(n)
+	n = filterFiles(n)
+	n = pushToTables(n)
+	n = pruneColumns(n, neededColumns{all: true})
+	n = pushLimits(n)
+	n = useTopN(n)
+	n = e.parallelize(n)
+	return n
+}
+
+// mapChildren returns a copy of the node with its children replaced by the
+// results of f.
+func mapChildren(n planNode, f func(planNode) planNode) planNode {
+	switch v := n.(type) {
+	case *joinNode:
+		return &joinNode{f(v.left), f(v.right), v.cond}
+	case *filterNode:
+		return &filterNode{f(v.input), v.cond}
+	case *aggregateNode:
+		return &aggregateNode{f(v.input), v.groupBy, v.aggs}
+	case *sortNode:
+		return &sortNode{f(v.input), v.orderBy}
+	case *topNode:
+		return &topNode{f(v.input), v.orderBy, v.n}
+	case *limitNode:
+		return &limitNode{f(v.input), v.n}
+	case *projectNode:
+		return &projectNode{f(v.input), v.selectors}
+	case *gatherNode:
+		return &gatherNode{f(v.input), v.workers}
+	}
+	return n
+}
+
+// foldConstants replaces the expressions that don't depend on rows with
+// their values and removes the filters that are always true.
+func (e Engine) foldConstants(n planNode) planNode {
+	n = mapChildren(n, e.foldConstants)
+	switch v := n.(type) {
+	case *joinNode:
+		return &joinNode{v.left, v.right, e.fold(v.cond)}
+	case *filterNode:
+		cond := e.fold(v.cond)
+		if isTrue(cond) {
+			return v.input
+		}
+		return &filterNode{v.input, cond}
+	case *sortNode:
+		orderBy := make([]orderspec, len(v.orderBy))
+		for i, o := range v.orderBy {
+			orderBy[i] = orderspec{o.desc, e.fold(o.expr)}
+		}
+		return &sortNode{v.input, orderBy}
+	case *projectNode:
+		// The folded selectors keep their original names.
+		selectors := make([]selector, len(v.selectors))
+		for i, s := range v.selectors {
+			selectors[i] = selector{e.fold(s.Expr), s.Alias}
+			if selectors[i].Alias == "" && selectors[i].Expr != s.Expr {
+				selectors[i].Alias = s.Expr.String()
+			}
+		}
+		return &projectNode{v.input, selectors}
+	}
+	return n
+}
+
+// fold returns the expression with its constant parts evaluated. Parts that
+// fail to evaluate are left as they are so that they fail at the same
+// point of the execution. Aggregates and user functions are never folded.
+func (e Engine) fold(x expression) expression {
+	var children []expression
+	var r expression
+	switch v := x.(type) {
+	case *functionkek:
+		args := make([]expression, len(v.Args))
+		for i, a := range v.Args {
+			args[i] = e.fold(a)
+		}
+		if _, ok := e.functions[strings.ToLower(v.Name)]; ok {
+			return &functionkek{v.Name, args}
+		}
+		r, children = &functionkek{v.Name, args}, args
+	case *as:
+		return &as{e.fold(v.Expr), v.TypeID}
+	case *binaryOperatorNode:
+		l, rt := e.fold(v.left), e.fold(v.right)
+		r, children = &binaryOperatorNode{v.op, l, rt}, []expression{l, rt}
+	case *fbinaryOr:
+		l, rt := e.fold(v.left), e.fold(v.right)
+		r, children = &fbinaryOr{l, rt}, []expression{l, rt}
+	case *fbinaryAnd:
+		l, rt := e.fold(v.left), e.fold(v.right)
+		// true AND x is x.
+		if isTrue(l) {
+			return rt
+		}
+		if isTrue(rt) {
+			return l
+		}
+		r, children = &fbinaryAnd{l, rt}, []expression{l, rt}
+	default:
+		return x
+	}
+	for _, c := range children {
+		if a, ok := c.(*as); ok {
+			c = a.Expr
+		}
+		if _, ok := c.(*Value); !ok {
+			return r
+		}
+	}
+	val, err := e.eval(r, nil, nil)
+	if err != nil {
+		return r
+	}
+	return &val
+}
+
+// isTrue tells whether the expression is the constant true.
+func isTrue(x expression) bool {
+	v, ok := x.(*Value)
+	return ok && v.Data == true
+}
+
+// pushFilters moves the parts of the filters above joins and of the join
+// conditions that refer to only one side of a join down to that side, so
+// that fewer rows get joined.
+func pushFilters(n planNode) planNode {
+	n = mapChildren(n, pushFilters)
+	var conds []expression
+	var j *joinNode
+	switch v := n.(type) {
+	case *filterNode:
+		input, ok := v.input.(*joinNode)
+		if !ok {
+			return n
+		}
+		j = input
+		conds = append(conjuncts(v.cond), conjuncts(j.cond)...)
+	case *joinNode:
+		j = v
+		conds = conjuncts(j.cond)
+	default:
+		return n
+	}
+
+	var left, right, both []expression
+	for _, c := range conds {
+		switch {
+		case refersOnlyTo(c, j.left, j.right):
+			left = append(left, c)
+		case refersOnlyTo(c, j.right, j.left):
+			right = append(right, c)
+		default:
+			both = append(both, c)
+		}
+	}
+	if len(left) == 0 && len(right) == 0 {
+		return n
+	}
+	r := &joinNode{j.left, j.right, &Value{Bool, true}}
+	if len(left) > 0 {
+		r.left = pushFilters(&filterNode{j.left, conjunction(left)})
+	}
+	if len(right) > 0 {
+		r.right = pushFilters(&filterNode{j.right, conjunction(right)})
+	}
+	if len(both) > 0 {
+		r.cond = conjunction(both)
+	}
+	return r
+}
+
+// conjuncts splits the condition into the parts joined by AND.
+func conjuncts(x expression) []expression {
+	if and, ok := x.(*fbinaryAnd); ok {
+		return append(conjuncts(and.left), conjuncts(and.right)...)
+	}
+	if isTrue(x) {
+		return nil
+	}
+	return []expression{x}
+}
+
+// conjunction joins the conditions with AND.
+func conjunction(xs []expression) expression {
+	r := xs[0]
+	for _, x := range xs[1:] {
+		r = &fbinaryAnd{r, x}
+	}
+	return r
+}
+
+// refersOnlyTo tells whether all column references in the condition
+// certainly resolve to the rows of side when the rows of side and other are
+// joined. A condition without column references doesn't belong to a side.
+func refersOnlyTo(x expression, side, other planNode) bool {
+	sideTables, sideColumns, ok := planColumns(side)
+	if !ok {
+		return false
+	}
+	otherTables, otherColumns, ok := planColumns(other)
+	if !ok {
+		return false
+	}
+	refs, ok := 0, true
+	traverse(x, func(node any) error {
+		switch v := node.(type) {
+		case *columnRef:
+			refs++
+			table, column := strings.ToLower(v.Table), strings.ToLower(v.Column)
+			if table == "" && sideColumns[column] && !otherColumns[column] {
+				return nil
+			}
+			// A qualified reference falls back to a column named "a.b".
+			if table != "" && sideTables[table] && !otherTables[table] && !otherColumns[table+"."+column] {
+				return nil
+			}
+			ok = false
+		case *aggregate, *placeholder:
+			ok = false
+		}
+		return nil
+	})
+	return ok && refs > 0
+}
+
+// planColumns returns the lower-case names of the tables and columns that
+// the node's rows may have. ok is false if they can't be known before
+// execution.
+func planColumns(n planNode) (tables, columns map[string]bool, ok bool) {
+	tables, columns = map[string]bool{}, map[string]bool{}
+	var add func(n planNode) bool
+	add = func(n planNode) bool {
+		switch v := n.(type) {
+		case *scanNode:
+			if p, ok := v.table.(interface{ partialColumns() bool }); ok && p.partialColumns() {
+				return false
+			}
+			cs, err := v.table.Columns()
+			if err != nil {
+				return false
+			}
+			tables[strings.ToLower(v.name)] = true
+			for _, c := range cs {
+				columns[strings.ToLower(c.Name)] = true
+			}
+			return true
+		case *joinNode:
+			return add(v.left) && add(v.right)
+		case *filterNode:
+			return add(v.input)
+		}
+		return false
+	}
+	ok = add(n)
+	return tables, columns, ok
+}
+
+// filterFiles gives the filters right above the scans to the scans, which
+// use them to skip the files of files tables. The filters stay in place, as
+// they are only checked against the file names. Filters above joins are
+// not used, because they may refer to the other tables.
+func filterFiles(n planNode) planNode {
+	n = mapChildren(n, filterFiles)
+	f, ok := n.(*filterNode)
+	if !ok {
+		return n
+	}
+	scan, ok := f.input.(*scanNode)
+	if !ok {
+		return n
+	}
+	r := *scan
+	r.filter = f.cond
+	return &filterNode{&r, f.cond}
+}
+
+// pushToTables offers the comparisons from the filters right above the
+// scans to the tables that can apply them.
+func pushToTables(n planNode) planNode {
+	n = mapChildren(n, pushToTables)
+	f, ok := n.(*filterNode)
+	if !ok {
+		return n
+	}
+	scan, ok := f.input.(*scanNode)
+	if !ok || scan.pushed != nil {
+		return n
+	}
+	ft, ok := scan.table.(FilterableTable)
+	if !ok {
+		return n
+	}
+	var offered []Comparison
+	var offeredConds, rest []expression
+	for _, c := range conjuncts(f.cond) {
+		if cmp, ok := comparison(c, scan); ok {
+			offered = append(offered, cmp)
+			offeredConds = append(offeredConds, c)
+		} else {
+			rest = append(rest, c)
+		}
+	}
+	if len(offered) == 0 {
+		return n
+	}
+	table, residual := ft.PushFilter(offered)
+	var pushed []expression
+	for i, c := range offered {
+		applied := true
+		for _, r := range residual {
+			if r == c {
+				applied = false
+			}
+		}
+		if applied {
+			pushed = append(pushed, offeredConds[i])
+		} else {
+			rest = append(rest, offeredConds[i])
+		}
+	}
+	if len(pushed) == 0 {
+		return n
+	}
+	r := *scan
+	r.table = table
+	r.pushed = conjunction(pushed)
+	if len(rest) == 0 {
+		return &r
+	}
+	return &filterNode{&r, conjunction(rest)}
+}
+
+// comparison converts the condition to a comparison of a column of the
+// scanned table with a scalar constant, if it is one.
+func comparison(x expression, scan *scanNode) (Comparison, bool) {
+	b, ok := x.(*binaryOperatorNode)
+	if !ok {
+		return Comparison{}, false
+	}
+	ref, ok := b.left.(*columnRef)
+	value, ok2 := b.right.(*Value)
+	op := b.op
+	if !ok || !ok2 {
+		// Turn 1 < x into x > 1.
+		ref, ok = b.right.(*columnRef)
+		value, ok2 = b.left.(*Value)
+		if !ok || !ok2 {
+			return Comparison{}, false
+		}
+		switch op {
+		case "<":
+			op = ">"
+		case ">":
+			op = "<"
+		}
+	}
+	switch value.Type {
+	case Int, Double, String, Bool:
+	default:
+		return Comparison{}, false
+	}
+	if ref.Table != "" && !strings.EqualFold(ref.Table, scan.name) {
+		return Comparison{}, false
+	}
+	columns, err := scan.table.Columns()
+	if err != nil {
+		return Comparison{}, false
+	}
+	for _, c := range columns {
+		if strings.EqualFold(c.Name, ref.Column) {
+			return Comparison{c.Name, op, *value}, true
+		}
+	}
+	return Comparison{}, false
+}
+
+// neededColumns is a set of lower-case column names, or all columns.
+type neededColumns struct {
+	all   bool
+	names map[string]bool
+}
+
+// with returns the set with the columns referenced in the expressions
+// added. A star outside of aggregates refers to all columns.
+func (s neededColumns) with(xs ...expression) neededColumns {
+	if s.all {
+		return s
+	}
+	r := neededColumns{names: map[string]bool{}}
+	for k := range s.names {
+		r.names[k] = true
+	}
+	for _, x := range xs {
+		if x == nil {
+			continue
+		}
+		if _, ok := x.(*star); ok {
+			return neededColumns{all: true}
+		}
+		traverse(x, func(node any) error {
+			if v, ok := node.(*columnRef); ok {
+				r.names[strings.ToLower(v.Column)] = true
+				if v.Table != "" {
+					r.names[strings.ToLower(v.Table+"."+v.Column)] = true
+				}
+			}
+			return nil
+		})
+	}
+	return r
+}
+
+// pruneColumns makes the scans drop the columns that are not in need or
+// referenced by the nodes between the scans and the projection.
+func pruneColumns(n planNode, need neededColumns) planNode {
+	switch v := n.(type) {
+	case *scanNode:
+		if need.all {
+			return n
+		}
+		r := *v
+		r.columns = scanColumns(v.table, need)
+		return &r
+	case *projectNode:
+		// The projection defines the columns of its output, so what is
+		// needed above it doesn't matter below.
+		need = neededColumns{names: map[string]bool{}}
+		for _, s := range v.selectors {
+			need = need.with(s.Expr)
+		}
+	case *joinNode:
+		need = need.with(v.cond)
+	case *filterNode:
+		need = need.with(v.cond)
+	case *aggregateNode:
+		need = need.with(v.groupBy...)
+		for _, a := range v.aggs {
+			for _, arg := range a.Args {
+				if _, ok := arg.(*star); !ok {
+					need = need.with(arg)
+				}
+			}
+		}
+	case *sortNode:
+		for _, o := range v.orderBy {
+			need = need.with(o.expr)
+		}
+	case *topNode:
+		for _, o := range v.orderBy {
+			need = need.with(o.expr)
+		}
+	}
+	return mapChildren(n, func(c planNode) planNode {
+		return pruneColumns(c, need)
+	})
+}
+
+// scanColumns returns the table's columns that are in the set, in the
+// table's order. If the table may have undeclared columns, all names from
+// the set are returned.
+func scanColumns(t Table, need neededColumns) []string {
+	r := []string{}
+	cs, err := t.Columns()
+	p, partial := t.(interface{ partialColumns() bool })
+	if err != nil || partial && p.partialColumns() {
+		for name := range need.names {
+			r = append(r, name)
+		}
+		sort.Strings(r)
+		return r
+	}
+	for _, c := range cs {
+		if need.names[strings.ToLower(c.Name)] {
+			r = append(r, c.Name)
+		}
+	}
+	return r
+}
+
+// pushLimits moves limits below projections, which produce a row for every
+// input row, and merges adjacent limits.
+func pushLimits(n planNode) planNode {
+	n = mapChildren(n, pushLimits)
+	l, ok := n.(*limitNode)
+	if !ok {
+		return n
+	}
+	switch v := l.input.(type) {
+	case *projectNode:
+		return &projectNode{pushLimits(&limitNode{v.input, l.n}), v.selectors}
+	case *limitNode:
+		if v.n < l.n {
+			return v
+		}
+		return &limitNode{v.input, l.n}
+	}
+	return n
+}
+
+// useTopN replaces limits over sorts with top-N selection, which needs
+// memory only for the groups it returns.
+func useTopN(n planNode) planNode {
+	n = mapChildren(n, useTopN)
+	if l, ok := n.(*limitNode); ok {
+		if s, ok := l.input.(*sortNode); ok {
+			return &topNode{s.input, s.orderBy, l.n}
+		}
+	}
+	return n
+}
+
+// parallelize puts gathers over the scans of tables that can be read in
+// parts, together with the filters right above the scans, if the engine has
+// more than one worker.
+func (e Engine) parallelize(n planNode) planNode {
+	if e.workers < 2 {
+		return n
+	}
+	if _, _, ok := scanChain(n); ok {
+		return &gatherNode{n, e.workers}
+	}
+	return mapChildren(n, e.parallelize)
+}
@@ -0,0 +1,172 @@
+package sql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func optimizerEngine(t *testing.T) Engine {
+	cars, err := JsonTable("test-data.json", JsonOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(map[string]Table{
+		"cars": cars,
+		"t1": dummy{
+			{"id": Value{Int, 1}, "name": Value{String, "one"}},
+			{"id": Value{Int, 2}, "name": Value{String, "two"}},
+			{"id": Value{Int, 3}, "name": Value{String, "three"}},
+		},
+		"t2": dummy{
+			{"bucket": Value{Int, 1}, "flag": Value{Bool, true}},
+			{"bucket": Value{Int, 2}, "flag": Value{Bool, false}},
+			{"bucket": Value{Int, 2}, "flag": Value{Bool, nil}},
+		},
+		"t3": dummy{
+			{"x": Value{Int, 1}, "id": Value{Int, 3}},
+			{"x": Value{Int, 2}, "id": Value{Int, 1}},
+		},
+	})
+}
+
+// runPlan executes the query with or without the optimizer.
+func runPlan(t *testing.T, e Engine, query string, optimize bool) []Row {
+	t.Helper()
+	q, err := e.Parse(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err = e.bind(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := e.plan(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if optimize {
+		p = e.optimize(p)
+	}
+	s, err := e.run(context.Background(), p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := s.Consume()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := make([]Row, len(groups))
+	for i, g := range groups {
+		rows[i] = g.row
+	}
+	return rows
+}
+
+func TestOptimizerKeepsResults(t *testing.T) {
+	queries := []string{
+		`select * from t1`,
+		`select name from t1 where id = 2`,
+		`select 1 = 1, 2 = 3 as b from t1`,
+		`select id from t1 where 1 = 1`,
+		`select id from t1 where 1 = 2 or id = 3`,
+		`select * from t1 join t2 on id = bucket`,
+		`select name, flag from t1 join t2 on id = bucket and flag`,
+		`select t1.name, t3.x from t1 join t3 on t1.id = t3.id where t3.x = 1`,
+		`select name, x from t1 join t3 on t1.id = t3.id where name = 'one' and x = 2`,
+		`select name, bucket from t1 join t2 on true where id = 1 or bucket = 1`,
+		`select name, bucket, x from t1 join t2 on id = bucket join t3 on t3.x = bucket where name = 'two'`,
+		`select bucket, count(*) from t1 join t2 on id = bucket where flag or flag = false group by bucket`,
+		`select count(*) from t1 join t2 on true`,
+		`select name from cars where year = 2009 and price > 31000`,
+		`select year, min(price) from cars where price > 1 group by year order by year`,
+		`select * from (select name, year from cars) limit 2`,
+		`select * from (select * from t1 limit 2) limit 1`,
+		`select * from (select * from t1 order by id desc) limit 2`,
+		`select id from t1 order by 1 = 1, id desc limit 2`,
+		`select bucket, flag from t2 order by bucket desc limit 2`,
+		`select bucket, flag from t2 order by flag limit 2`,
+		`select bucket, flag from t2 order by flag desc, bucket limit 5`,
+		`select bucket from t2 order by bucket limit 0`,
+		`select substring('abc', 2), cast('5' as int) from t1`,
+	}
+	for _, q := range queries {
+		t.Run(q, func(t *testing.T) {
+			e := optimizerEngine(t)
+			want := runPlan(t, e, q, false)
+			got := runPlan(t, e, q, true)
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestOptimizerRules(t *testing.T) {
+	cases := []struct {
+		query string
+		plan  []string
+	}{
+		{
+			`explain select id, 1 = 1 from t1 where 2 = 2 and id = 1`,
+			[]string{
+				`Project "id", true AS 1 = 1`,
+				`  Filter "id" = 1`,
+				`    Scan t1: id`,
+			},
+		},
+		{
+			`explain select id from t1 where 2 = 2`,
+			[]string{
+				`Project "id"`,
+				`  Scan t1: id`,
+			},
+		},
+		{
+			`explain select name, x from t1 join t3 on t1.id = t3.id and x = 1 where name = 'one'`,
+			[]string{
+				`Project "name", "x"`,
+				`  Join on "t1"."id" = "t3"."id"`,
+				`    Filter "name" = one`,
+				`      Scan t1: id, name`,
+				`    Filter "x" = 1`,
+				`      Scan t3: id, x`,
+			},
+		},
+		{
+			`explain select count(*) from t1`,
+			[]string{
+				`Project count(*)`,
+				`  Aggregate count(*)`,
+				`    Scan t1: no columns`,
+			},
+		},
+		{
+			`explain select * from (select name from t1) limit 1`,
+			[]string{
+				`Project *`,
+				`  Project "name"`,
+				`    Limit 1`,
+				`      Scan t1: name`,
+			},
+		},
+		{
+			`explain select * from (select * from t1 limit 5) limit 2`,
+			[]string{
+				`Project *`,
+				`  Project *`,
+				`    Limit 2`,
+				`      Scan t1`,
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			got := planLines(t, optimizerEngine(t), c.query)
+			if diff := cmp.Diff(c.plan, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,406 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// partitionReader opens a part of a table's rows. It returns the function
+// that reads the rows and the function that releases the reader, which may
+// be nil.
+type partitionReader func() (func() (map[string]Value, error), func() error)
+
+// partitioned tells whether the table can be read in parts on several
+// goroutines.
+func partitioned(t Table) bool {
+	switch v := t.(type) {
+	case *filesTable:
+		return len(v.paths) > 1
+	case *jsonStream:
+		return v.opts.Schema != nil
+	}
+	return false
+}
+
+// scanChain returns the scan at the bottom of a chain of filters and the
+// filters from the bottom up, if the scan's table can be read in parts.
+func scanChain(n planNode) (*scanNode, []*filterNode, bool) {
+	switch v := n.(type) {
+	case *scanNode:
+		return v, nil, partitioned(v.table)
+	case *filterNode:
+		scan, filters, ok := scanChain(v.input)
+		return scan, append(filters, v), ok
+	}
+	return nil, nil, false
+}
+
+// tablePartitions returns the readers of the parts of the scanned table in
+// the order of their rows.
+func (e Engine) tablePartitions(n *scanNode) (*Stream[partitionReader], error) {
+	switch t := n.table.(type) {
+	case *filesTable:
+		return t.partitions(e.fileFilter(n.name, n.filter), n.columns), nil
+	case *jsonStream:
+		var keep map[string]bool
+		if n.columns != nil {
+			keep = columnNames(n.columns)
+		}
+		return t.chunks(keep), nil
+	}
+	return nil, fmt.Errorf("table %s can't be read in parts", n.name)
+}
+
+// knownColumns is a table with its columns read in advance, so that the
+// workers reading its parts don't ask the table for them at the same time.
+type knownColumns struct {
+	Table
+	columns []Column
+}
+
+func (t knownColumns) Columns() ([]Column, error) {
+	return t.columns, nil
+}
+
+// part is a part of a table given to a worker, with the worker's output.
+type part struct {
+	read  partitionReader
+	table Table
+
+	// rows passes the batches of the part's rows that passed the filters
+	// when the rows are gathered. It is closed after the last batch.
+	rows chan []group
+
+	// groups are the partial groups of the part's rows, in the order of
+	// their first rows, when the rows are aggregated.
+	groups []partialGroup
+
+	// n is the number of the part's rows that passed the filters.
+	n int
+
+	// err is the error that stopped the part. It is set before done is
+	// closed.
+	err  error
+	done chan struct{}
+}
+
+// partialGroup is a group folded from some of the rows of a table.
+type partialGroup struct {
+	key   string
+	state *groupState
+}
+
+const (
+	// batchSize is the number of rows the workers pass at once.
+	batchSize = 256
+
+	// partBatches is the number of batches of a part that may wait to be
+	// read.
+	partBatches = 16
+)
+
+// parallelRun is the reading of a table's parts by a gather's workers.
+type parallelRun struct {
+	// parts passes the parts in the order of the table's rows, at most
+	// as many ahead of the reader as there are workers. It is closed after
+	// the last part.
+	parts chan *part
+	quit  chan struct{}
+	wg    sync.WaitGroup
+
+	// mu guards the stats of the nodes under the gather, which the workers
+	// add to after every part.
+	mu sync.Mutex
+}
+
+// runParts starts reading the parts of the table scanned at the bottom of
+// the gather. Every part is read on one of the workers, which applies the
+// filters above the scan and calls work with the part and the stream of
+// its rows. work has to return once quit is closed. If stats is not nil,
+// the scan and the filters record in it the rows and the time summed over
+// the workers.
+func (e Engine) runParts(ctx context.Context, n *gatherNode, stats map[planNode]*nodeStats, work func(p *part, rows *Stream[group], quit <-chan struct{}) error) (*parallelRun, error) {
+	scan, filters, ok := scanChain(n.input)
+	if !ok {
+		return nil, fmt.Errorf("can't read the input of %s in parts", n)
+	}
+	var shared []*nodeStats
+	if stats != nil {
+		nodes := []planNode{scan}
+		for _, f := range filters {
+			nodes = append(nodes, f)
+		}
+		for _, x := range nodes {
+			stats[x] = &nodeStats{}
+			shared = append(shared, stats[x])
+		}
+	}
+	source, err := e.tablePartitions(scan)
+	if err != nil {
+		return nil, err
+	}
+	r := &parallelRun{
+		parts: make(chan *part, n.workers),
+		quit:  make(chan struct{}),
+	}
+	jobs := make(chan *part)
+	r.wg.Add(1 + n.workers)
+
+	go func() {
+		defer r.wg.Done()
+		defer close(jobs)
+		defer close(r.parts)
+		defer source.Close()
+		var table Table
+		for {
+			read, done, err := source.Next()
+			if done {
+				return
+			}
+			// The table's columns are complete once the first part is
+			// returned.
+			if err == nil && table == nil {
+				var columns []Column
+				columns, err = scan.table.Columns()
+				table = knownColumns{scan.table, columns}
+			}
+			p := &part{read: read, table: table, rows: make(chan []group, partBatches), done: make(chan struct{})}
+			if err != nil {
+				p.err = err
+				close(p.rows)
+				close(p.done)
+				select {
+				case r.parts <- p:
+				case <-r.quit:
+				}
+				return
+			}
+			select {
+			case r.parts <- p:
+			case <-r.quit:
+				return
+			}
+			select {
+			case jobs <- p:
+			case <-r.quit:
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < n.workers; i++ {
+		go func() {
+			defer r.wg.Done()
+			for p := range jobs {
+				next, release := p.read()
+				local := make([]nodeStats, len(shared))
+				rows := e.scanRows(ctx, scan, p.table, next, release)
+				if shared != nil {
+					rows = measured(rows, &local[0])
+				}
+				for i, f := range filters {
+					cond := f.cond
+					rows = rows.filter(func(g group) (bool, error) {
+						return e.evalCondition(cond, g.row)
+					})
+					if shared != nil {
+						rows = measured(rows, &local[i+1])
+					}
+				}
+				err := work(p, rows, r.quit)
+				if err2 := rows.Close(); err == nil {
+					err = err2
+				}
+				r.mu.Lock()
+				for i, st := range shared {
+					st.rows += local[i].rows
+					st.time += local[i].time
+				}
+				r.mu.Unlock()
+				p.err = err
+				close(p.done)
+			}
+		}()
+	}
+	return r, nil
+}
+
+// stop makes the workers quit and waits for them.
+func (r *parallelRun) stop() error {
+	close(r.quit)
+	r.wg.Wait()
+	return nil
+}
+
+// gather returns the rows of the parts of the gather's table in the order
+// of the parts, which is the order in which the table returns them.
+func (e Engine) gather(ctx context.Context, n *gatherNode, stats map[planNode]*nodeStats) (*Stream[group], error) {
+	r, err := e.runParts(ctx, n, stats, func(p *part, rows *Stream[group], quit <-chan struct{}) error {
+		defer close(p.rows)
+		batch := make([]group, 0, batchSize)
+		for {
+			select {
+			case <-quit:
+				return nil
+			default:
+			}
+			g, done, err := rows.Next()
+			if err == nil && !done {
+				batch = append(batch, g)
+				if len(batch) < batchSize {
+					continue
+				}
+			}
+			// The rows before an error are passed as well.
+			if len(batch) > 0 {
+				select {
+				case p.rows <- batch:
+				case <-quit:
+					return nil
+				}
+				batch = make([]group, 0, batchSize)
+			}
+			if err != nil || done {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	var current *part
+	var batch []group
+	return &Stream[group]{
+		"gather",
+		func() (group, bool, error) {
+			for {
+				if len(batch) > 0 {
+					g := batch[0]
+					batch = batch[1:]
+					return g, false, nil
+				}
+				if current == nil {
+					p, ok := <-r.parts
+					if !ok {
+						return group{}, true, nil
+					}
+					current = p
+				}
+				b, ok := <-current.rows
+				if ok {
+					batch = b
+					continue
+				}
+				<-current.done
+				if current.err != nil {
+					return group{}, false, current.err
+				}
+				current = nil
+			}
+		},
+		r.stop,
+	}, nil
+}
+
+// gatherGroups folds the rows of every part of the gather's table into
+// partial groups on the workers and merges the partial groups in the order
+// of the parts, so that the groups, their order and their first rows are
+// the same as when the rows are folded one by one. The merged groups are
+// counted in mem. If stats is not nil, the gather and the nodes under it
+// record their statistics in it.
+func (e Engine) gatherGroups(ctx context.Context, n *gatherNode, keys []expression, aggs []*aggregate, stats map[planNode]*nodeStats, mem *memoryUsage) (*Stream[group], error) {
+	index := map[string]int{}
+	var states []*groupState
+	if len(keys) == 0 {
+		// Without keys, there is one group even if there are no rows.
+		all, err := newGroupState(e, aggs)
+		if err != nil {
+			return nil, err
+		}
+		index[groupKey(nil)] = 0
+		states = append(states, all)
+	}
+	st := &nodeStats{}
+	if stats != nil {
+		stats[n] = st
+	}
+	r, err := e.runParts(ctx, n, stats, func(p *part, rows *Stream[group], quit <-chan struct{}) error {
+		index := map[string]int{}
+		for {
+			select {
+			case <-quit:
+				return nil
+			default:
+			}
+			g, done, err := rows.Next()
+			if err != nil || done {
+				return err
+			}
+			p.n++
+			key, err := e.keyValues(keys, g.row)
+			if err != nil {
+				return err
+			}
+			k := groupKey(key)
+			i, ok := index[k]
+			if !ok {
+				state, err := newGroupState(e, aggs)
+				if err != nil {
+					return err
+				}
+				i = len(p.groups)
+				index[k] = i
+				p.groups = append(p.groups, partialGroup{k, state})
+			}
+			if err := p.groups[i].state.step(g.row); err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	var groups *Stream[group]
+	return &Stream[group]{
+		"gather.group",
+		func() (group, bool, error) {
+			if groups != nil {
+				return groups.Next()
+			}
+			start := time.Now()
+			for p := range r.parts {
+				<-p.done
+				if p.err != nil {
+					return group{}, false, p.err
+				}
+				st.rows += p.n
+				for _, pg := range p.groups {
+					i, ok := index[pg.key]
+					if !ok {
+						index[pg.key] = len(states)
+						states = append(states, pg.state)
+						mem.add(rowSize(pg.state.row) + 64*int64(len(aggs)+1))
+						continue
+					}
+					if err := states[i].merge(pg.state); err != nil {
+						return group{}, false, err
+					}
+				}
+			}
+			st.time += time.Since(start)
+			result := make([]group, len(states))
+			for i, s := range states {
+				g, err := s.final()
+				if err != nil {
+					return group{}, false, err
+				}
+				result[i] = g
+			}
+			groups = arrstream(result)
+			return groups.Next()
+		},
+		r.stop,
+	}, nil
+}
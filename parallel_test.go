@@ -0,0 +1,154 @@
+package sql
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// parallelEngine returns an engine with the same rows in a table of several
+// files, f, and in a JSON stream with a schema, j.
+func parallelEngine(t *testing.T, dir string) Engine {
+	var all strings.Builder
+	for i := 0; i < 5; i++ {
+		var data strings.Builder
+		for j := 0; j < 700; j++ {
+			n := i*700 + j
+			fmt.Fprintf(&data, `{"n": %d, "k": %d, "s": "s%d"}`+"\n", n, n%37, n%5)
+		}
+		all.WriteString(data.String())
+		path := filepath.Join(dir, fmt.Sprintf("part-%d.ndjson", i))
+		if err := os.WriteFile(path, []byte(data.String()), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := FilesTable(dir, func(path string, r io.Reader) Table {
+		return JsonStream(r, JsonOptions{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := &Schema{Columns: []Column{{"n", Int, false}, {"k", Int, false}, {"s", String, false}}}
+	stream := JsonStream(strings.NewReader(all.String()), JsonOptions{Schema: schema})
+	return New(map[string]Table{"f": files, "j": stream})
+}
+
+func TestParallel(t *testing.T) {
+	queries := []string{
+		`select n, k from f order by k desc, s`,
+		`select * from f where k = 3`,
+		`select k, count(*), min(n) from f group by k`,
+		`select count(*) from f where k > 100`,
+		`select _file, count(*) from f group by _file`,
+		`select n from j where s = 's1' limit 10`,
+		`select s, count(*) from j group by s order by count(*) desc, s`,
+		`select distinct s from j`,
+		`select count(*), min(s) from j`,
+	}
+	dir := t.TempDir()
+	for _, q := range queries {
+		t.Run(q, func(t *testing.T) {
+			want, err := parallelEngine(t, dir).ExecString(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parallelEngine(t, dir).WithWorkers(4).ExecString(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestParallelPlan(t *testing.T) {
+	e := parallelEngine(t, t.TempDir()).WithWorkers(4)
+	got := planLines(t, e, `explain select k, count(*) from f where n > 10 group by k`)
+	want := []string{
+		`Project "k", count(*)`,
+		`  Aggregate by "k": count(*)`,
+		"    Gather: 4 workers",
+		`      Filter "n" > 10`,
+		"        Scan f: k, n",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestParallelExplainAnalyze(t *testing.T) {
+	stats := regexp.MustCompile(` time=\S+ memory=\S+\)$`)
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{
+			`explain analyze select k, count(*) from f where n > 10 group by k`,
+			[]string{
+				`Project "k", count(*) (rows=37)`,
+				`  Aggregate by "k": count(*) (rows=37)`,
+				"    Gather: 4 workers (rows=3489)",
+				`      Filter "n" > 10 (rows=3489)`,
+				"        Scan f: k, n (rows=3500)",
+			},
+		},
+		{
+			`explain analyze select n from f where k = 3`,
+			[]string{
+				`Project "n" (rows=95)`,
+				"  Gather: 4 workers (rows=95)",
+				`    Filter "k" = 3 (rows=95)`,
+				"      Scan f: k, n (rows=3500)",
+			},
+		},
+	}
+	for _, c := range cases {
+		e := parallelEngine(t, t.TempDir()).WithWorkers(4)
+		var got []string
+		for _, line := range planLines(t, e, c.query) {
+			got = append(got, stats.ReplaceAllString(line, ")"))
+		}
+		if diff := cmp.Diff(c.want, got); diff != "" {
+			t.Error(diff)
+		}
+	}
+}
+
+func TestParallelErrors(t *testing.T) {
+	var data strings.Builder
+	for i := 0; i < 3000; i++ {
+		if i == 2500 {
+			data.WriteString("{\"n\": \"x\"}\n")
+			continue
+		}
+		fmt.Fprintf(&data, "{\"n\": %d}\n", i)
+	}
+	schema := &Schema{Columns: []Column{{"n", Int, false}}, Strict: true}
+	table := JsonStream(strings.NewReader(data.String()), JsonOptions{Schema: schema})
+	_, err := New(map[string]Table{"t": table}).WithWorkers(4).ExecString(`select count(*) from t`)
+	if err == nil || !strings.Contains(err.Error(), "line 2501") {
+		t.Errorf("got %v, want an error at line 2501", err)
+	}
+
+	var skipped []int
+	table = JsonStream(strings.NewReader(data.String()), JsonOptions{
+		Schema:        schema,
+		OnError:       SkipOnError,
+		ErrorCallback: func(err *RowError) { skipped = append(skipped, err.Line) },
+	})
+	r, err := New(map[string]Table{"t": table}).WithWorkers(4).ExecString(`select count(*) from t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]any{2999, []int{2501}}, []any{r[0][0].Data.Data, skipped}); diff != "" {
+		t.Error(diff)
+	}
+}
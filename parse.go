@@ -1,32 +1,94 @@
 package sql
 
 import (
-	"fmt"
 	"strconv"
+	"strings"
 )
 
 // Parse parses an SQL string and returns a query syntax tree.
 func Parse(sqlString string) (Query, error) {
+	return parse(sqlString, isAggregate)
+}
+
+// Parse parses an SQL string taking into account the functions registered
+// on the engine.
+func (e Engine) Parse(sqlString string) (Query, error) {
+	return parse(sqlString, e.isAggregate)
+}
+
+func parse(sqlString string, isAggregate func(string) bool) (Query, error) {
 	b := tokenizer{
-		b:     NewParsebuf(sqlString),
-		peeks: nil,
+		b:           NewParsebuf(sqlString),
+		peeks:       nil,
+		isAggregate: isAggregate,
 	}
-	result, err := readQuery(&b)
+	result, err := readStatement(&b)
 	if err != nil {
 		return result, err
 	}
-	if b.peek().t != tEnd {
-		fmt.Println(FormatQuery(result))
-		return result, fmt.Errorf("unexpected token: %s", b.peek())
+	t, err := b.next()
+	if err != nil {
+		return result, err
+	}
+	if t.t != tEnd {
+		return result, b.errorAt(t, nil, "")
 	}
 	return result, nil
 }
 
+// readStatement reads a SELECT, DESCRIBE or EXPLAIN statement.
+func readStatement(b *tokenizer) (Query, error) {
+	if b.eati(tKeyword, "EXPLAIN") {
+		return readExplain(b)
+	}
+	if b.eati(tKeyword, "DESCRIBE") {
+		return readDescribe(b)
+	}
+	return readQuery(b)
+}
+
+// readExplain reads an EXPLAIN statement, which is represented as a query
+// selecting everything from the plan of the explained query.
+func readExplain(b *tokenizer) (Query, error) {
+	analyze := b.eati(tKeyword, "ANALYZE")
+	var q Query
+	var err error
+	if b.eati(tKeyword, "DESCRIBE") {
+		q, err = readDescribe(b)
+	} else {
+		q, err = readQuery(b)
+	}
+	if err != nil {
+		return Query{}, err
+	}
+	return Query{
+		From:      &explain{q, analyze},
+		Selectors: []selector{{Expr: &star{}}},
+	}, nil
+}
+
+// readDescribe reads a DESCRIBE statement, which is represented as a query
+// selecting everything from the table's description.
+func readDescribe(b *tokenizer) (Query, error) {
+	t, err := b.next()
+	if err != nil {
+		return Query{}, err
+	}
+	if t.t != tIdentifier {
+		return Query{}, b.errorAt(t, []string{"table name"}, "")
+	}
+	return Query{
+		From:      &describe{t.val},
+		Selectors: []selector{{Expr: &star{}}},
+	}, nil
+}
+
 func readQuery(b *tokenizer) (Query, error) {
 	var result Query
 	if !b.eati(tKeyword, "SELECT") {
-		return result, fmt.Errorf("SELECT expected, got %s", b.peek())
+		return result, b.expected("SELECT")
 	}
+	result.Distinct = b.eati(tKeyword, "DISTINCT")
 	for {
 		e, err := readSelector(b)
 		if err != nil {
@@ -45,7 +107,7 @@ func readQuery(b *tokenizer) (Query, error) {
 				return result, err
 			}
 			if !b.eati(tOp, ")") {
-				return result, fmt.Errorf("expected ')' after subquery, got %s", b.peek())
+				return result, b.expected(")")
 			}
 			result.From = &q
 		} else {
@@ -55,11 +117,15 @@ func readQuery(b *tokenizer) (Query, error) {
 				return result, err
 			}
 			if from.t != tIdentifier {
-				return result, fmt.Errorf("expected identifier, got %s", from)
+				return result, b.errorAt(from, []string{"table name", "("}, "")
 			}
 			result.From = &tableName{from.val}
 		}
-		result.Joins = readJoins(b)
+		joins, err := readJoins(b)
+		if err != nil {
+			return result, err
+		}
+		result.Joins = joins
 	}
 	if b.eati(tKeyword, "WHERE") {
 		var err error
@@ -70,7 +136,7 @@ func readQuery(b *tokenizer) (Query, error) {
 	}
 	if b.eati(tKeyword, "GROUP") {
 		if !b.eati(tKeyword, "BY") {
-			return result, fmt.Errorf("expected BY after GROUP, got '%s", b.peek())
+			return result, b.expected("BY")
 		}
 		for {
 			gr, err := readExpression(b)
@@ -85,10 +151,14 @@ func readQuery(b *tokenizer) (Query, error) {
 	}
 	if b.eati(tKeyword, "ORDER") {
 		if !b.eati(tKeyword, "BY") {
-			return result, fmt.Errorf("expected BY after ORDER, got '%s", b.peek())
+			return result, b.expected("BY")
 		}
 		for {
-			result.OrderBy = append(result.OrderBy, readOrder(b))
+			o, err := readOrder(b)
+			if err != nil {
+				return result, err
+			}
+			result.OrderBy = append(result.OrderBy, o)
 			if !b.eat(tOp, ",") {
 				break
 			}
@@ -100,11 +170,11 @@ func readQuery(b *tokenizer) (Query, error) {
 			return result, err
 		}
 		if n.t != tNumber {
-			return result, fmt.Errorf("expecting a number after LIMIT, got %s", n)
+			return result, b.errorAt(n, []string{"number"}, "")
 		}
 		val, err := strconv.Atoi(n.val)
-		if err != nil {
-			return result, err
+		if err != nil || val < 0 {
+			return result, b.errorf(n, "invalid limit")
 		}
 		result.Limit.Set = true
 		result.Limit.Value = val
@@ -112,10 +182,10 @@ func readQuery(b *tokenizer) (Query, error) {
 	return result, nil
 }
 
-func readOrder(b *tokenizer) orderspec {
+func readOrder(b *tokenizer) (orderspec, error) {
 	expr, err := readExpression(b)
 	if err != nil {
-		panic(err)
+		return orderspec{}, err
 	}
 	desc := false
 	switch true {
@@ -124,7 +194,7 @@ func readOrder(b *tokenizer) orderspec {
 	case b.eat(tKeyword, "ASC"):
 		//
 	}
-	return orderspec{desc, expr}
+	return orderspec{desc, expr}, nil
 }
 
 func readSelector(b *tokenizer) (selector, error) {
@@ -141,42 +211,42 @@ func readSelector(b *tokenizer) (selector, error) {
 			return selector{}, err
 		}
 		if alias.t != tIdentifier {
-			return selector{}, fmt.Errorf("expected identifier after AS, got %s", alias)
+			return selector{}, b.errorAt(alias, []string{"alias"}, "")
 		}
 		return selector{Expr: expr, Alias: alias.val}, nil
 	}
 	return selector{Expr: expr}, nil
 }
 
-func readJoins(b *tokenizer) []joinspec {
+func readJoins(b *tokenizer) ([]joinspec, error) {
 	var r []joinspec
 	for b.eat(tKeyword, "JOIN") {
 		table, err := b.next()
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		if table.t != tIdentifier {
-			panic(fmt.Errorf("expected identifier, got %s", table))
+			return nil, b.errorAt(table, []string{"table name"}, "")
 		}
 		if !b.eat(tKeyword, "ON") {
-			panic(fmt.Errorf("expected ON, got '%s'", b.peek()))
+			return nil, b.expected("ON")
 		}
 		condition, err := readExpression(b)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		r = append(r, joinspec{&tableName{table.val}, condition})
 	}
-	return r
+	return r, nil
 }
 
 func readExpression(b *tokenizer) (expression, error) {
-	e, err := readExpr1(b)
+	e, err := readExpr2(b)
 	if err != nil {
 		return nil, err
 	}
 	for b.eati(tKeyword, "OR") {
-		e2, err := readExpr1(b)
+		e2, err := readExpr2(b)
 		if err != nil {
 			return nil, err
 		}
@@ -185,6 +255,22 @@ func readExpression(b *tokenizer) (expression, error) {
 	return e, nil
 }
 
+// readExpr2 reads a chain of AND operands, which bind tighter than OR.
+func readExpr2(b *tokenizer) (expression, error) {
+	e, err := readExpr1(b)
+	if err != nil {
+		return nil, err
+	}
+	for b.eati(tKeyword, "AND") {
+		e2, err := readExpr1(b)
+		if err != nil {
+			return nil, err
+		}
+		e = &fbinaryAnd{e, e2}
+	}
+	return e, nil
+}
+
 func readExpr1(b *tokenizer) (expression, error) {
 	e, err := readExpr0(b)
 	if err != nil {
@@ -206,6 +292,9 @@ func readExpr0(b *tokenizer) (expression, error) {
 	if scalar, err := readScalar(b); scalar != nil || err != nil {
 		return scalar, err
 	}
+	if p, err := readPlaceholder(b); p != nil || err != nil {
+		return p, err
+	}
 	if b.eati(tKeyword, "TRUE") {
 		return &Value{Bool, true}, nil
 	}
@@ -214,7 +303,7 @@ func readExpr0(b *tokenizer) (expression, error) {
 	}
 	if b.eati(tKeyword, "ARRAY") {
 		if !b.eat(tOp, "[") {
-			return nil, fmt.Errorf("[ expected, got %s", b.peek())
+			return nil, b.expected("[")
 		}
 		var array []Value
 		for {
@@ -231,7 +320,7 @@ func readExpr0(b *tokenizer) (expression, error) {
 			}
 		}
 		if !b.eat(tOp, "]") {
-			return nil, fmt.Errorf("] expected, got %s", b.peek())
+			return nil, b.expected(",", "]")
 		}
 		return &Value{Array, array}, nil
 	}
@@ -241,16 +330,16 @@ func readExpr0(b *tokenizer) (expression, error) {
 		return nil, err
 	}
 	if name1.t != tIdentifier {
-		return nil, fmt.Errorf("identifier expected, got %s", name1)
+		return nil, b.errorAt(name1, []string{"expression"}, "")
 	}
 
-	if b.peek().t == tOp && b.peek().val == "(" && isAggregate(name1.val) {
+	if b.peek().t == tOp && b.peek().val == "(" && b.isAggregate(name1.val) {
 		b.next()
 		args := []expression{}
 		if b.eat(tOp, "*") {
 			args = append(args, &star{})
 			if !b.eat(tOp, ")") {
-				return nil, fmt.Errorf("expecting ) after %s(*", name1.val)
+				return nil, b.expected(")")
 			}
 		} else {
 			for {
@@ -264,7 +353,7 @@ func readExpr0(b *tokenizer) (expression, error) {
 				}
 			}
 			if !b.eat(tOp, ")") {
-				return nil, fmt.Errorf(") expected, got %s", b.peek())
+				return nil, b.expected(",", ")")
 			}
 		}
 		return &aggregate{name1.val, args}, nil
@@ -282,6 +371,9 @@ func readExpr0(b *tokenizer) (expression, error) {
 				if err != nil {
 					return nil, err
 				}
+				if dt.t != tIdentifier && dt.t != tKeyword {
+					return nil, b.errorAt(dt, []string{"type name"}, "")
+				}
 				e = &as{e, getTypeID(dt.val)}
 			}
 			args = append(args, e)
@@ -290,23 +382,54 @@ func readExpr0(b *tokenizer) (expression, error) {
 			}
 		}
 		if !b.eat(tOp, ")") {
-			return nil, fmt.Errorf(") expected, got %s", b.peek())
+			return nil, b.expected(",", ")")
 		}
 		return &functionkek{name1.val, args}, nil
 	}
 
 	if b.eat(tOp, ".") {
-		name2, err := b.next()
-		if err != nil {
-			return nil, err
-		}
-		if name2.t != tIdentifier {
-			return nil, fmt.Errorf("identifier expected, got %s", name2)
+		// a.b.c is column "b.c" of table "a", or column "a.b.c".
+		var names []string
+		for {
+			name2, err := b.next()
+			if err != nil {
+				return nil, err
+			}
+			if name2.t != tIdentifier {
+				return nil, b.errorAt(name2, []string{"column name"}, "")
+			}
+			names = append(names, name2.val)
+			if !b.eat(tOp, ".") {
+				break
+			}
 		}
-		return &columnRef{name1.val, name2.val}, nil
+		return &columnRef{Table: name1.val, Column: strings.Join(names, ".")}, nil
 	}
 
-	return &columnRef{"", name1.val}, nil
+	return &columnRef{Column: name1.val}, nil
+}
+
+func readPlaceholder(b *tokenizer) (*placeholder, error) {
+	if b.peek().t != tPlaceholder {
+		return nil, nil
+	}
+	t, err := b.next()
+	if err != nil {
+		return nil, err
+	}
+	switch t.val[0] {
+	case '?':
+		b.positional++
+		return &placeholder{Text: t.val, Index: b.positional}, nil
+	case '$':
+		n, err := strconv.Atoi(t.val[1:])
+		if err != nil || n < 1 {
+			return nil, b.errorf(t, "parameter numbers start with 1")
+		}
+		return &placeholder{Text: t.val, Index: n}, nil
+	default:
+		return &placeholder{Text: t.val, Name: t.val[1:]}, nil
+	}
 }
 
 func readScalar(b *tokenizer) (*Value, error) {
@@ -324,7 +447,7 @@ func readScalar(b *tokenizer) (*Value, error) {
 		}
 		n, err := strconv.Atoi(s.val)
 		if err != nil {
-			return nil, err
+			return nil, b.errorf(s, "number out of range")
 		}
 		return &Value{Int, n}, nil
 	}
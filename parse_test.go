@@ -11,11 +11,43 @@ func TestTrailing(t *testing.T) {
 	if err == nil {
 		t.Fatalf("expected an error, got nil")
 	}
-	if diff := cmp.Diff("unexpected token: [identifier kek]", err.Error()); diff != "" {
+	if diff := cmp.Diff(`syntax error at line 1, column 24: unexpected "kek"`, err.Error()); diff != "" {
 		t.Fatalf("%s", diff)
 	}
 }
 
+func TestSyntaxErrors(t *testing.T) {
+	cases := []struct {
+		s   string
+		err *SyntaxError
+	}{
+		{`selec id from t`, &SyntaxError{1, 1, "selec", []string{"SELECT"}, ""}},
+		{`select id from t join u id = 1`, &SyntaxError{1, 25, "id", []string{"ON"}, ""}},
+		{`select id from t join`, &SyntaxError{1, 22, "", []string{"table name"}, ""}},
+		{`select id from t order id`, &SyntaxError{1, 24, "id", []string{"BY"}, ""}},
+		{`select id from t order by`, &SyntaxError{1, 26, "", []string{"expression"}, ""}},
+		{"select id\nfrom t\nwhere name = 'x", &SyntaxError{3, 14, "'x", nil, "unterminated quote, ' expected"}},
+		{`select f(a, b from t`, &SyntaxError{1, 15, "FROM", []string{",", ")"}, ""}},
+		{`select id from t limit x`, &SyntaxError{1, 24, "x", []string{"number"}, ""}},
+		{`select id from t where a = $0`, &SyntaxError{1, 28, "$0", nil, "parameter numbers start with 1"}},
+		{`select id from t where a = ~`, &SyntaxError{1, 28, "~", nil, "unexpected character"}},
+		{`select "ié", @ from t`, &SyntaxError{1, 14, "@", nil, "unexpected character"}},
+		{`select é from t`, &SyntaxError{1, 8, "é", nil, "unexpected character"}},
+	}
+	for _, c := range cases {
+		t.Run(c.s, func(t *testing.T) {
+			_, err := Parse(c.s)
+			se, ok := err.(*SyntaxError)
+			if !ok {
+				t.Fatalf("expected a syntax error, got %v", err)
+			}
+			if diff := cmp.Diff(c.err, se); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
 func TestParse2(t *testing.T) {
 	cases := []struct {
 		s string
@@ -2,6 +2,7 @@ package sql
 
 import (
 	"strings"
+	"unicode/utf8"
 )
 
 // Parsebuf is a string container with utility methods for writing hand-crafred
@@ -67,3 +68,20 @@ func (b *Parsebuf) Literal(literal string) bool {
 func (b *Parsebuf) Rest() string {
 	return b.str[b.pos:]
 }
+
+// Pos returns the offset of the next character to read.
+func (b *Parsebuf) Pos() int {
+	return b.pos
+}
+
+// Position returns the line and the column of the given offset, both
+// starting with 1. Columns are counted in characters.
+func (b *Parsebuf) Position(offset int) (line, column int) {
+	if offset > len(b.str) {
+		offset = len(b.str)
+	}
+	before := b.str[:offset]
+	line = strings.Count(before, "\n") + 1
+	column = utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:]) + 1
+	return line, column
+}
@@ -0,0 +1,525 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// planNode is an operator of a logical query plan. Operators take their
+// input from their children and produce a stream of groups: rows below the
+// aggregation and groups of rows above it.
+type planNode interface {
+	// children returns the node's inputs.
+	children() []planNode
+
+	// String describes the node in a single line.
+	String() string
+}
+
+// scanNode reads the rows of a table. filter, if set, is the condition on
+// the table's rows used to skip files of a files table. Rows that don't
+// match it are not removed by the scan.
+type scanNode struct {
+	name   string
+	table  Table
+	filter expression
+
+	// columns, if not nil, lists the only columns the query needs. The
+	// other cells are dropped from the rows.
+	columns []string
+
+	// pushed is the condition that the table applies itself, if any.
+	pushed expression
+}
+
+// valuesNode produces fixed rows.
+type valuesNode struct {
+	name string
+	rows []Row
+}
+
+// explainNode produces the lines of the plan's description. With analyze,
+// it runs the plan first and adds the execution statistics.
+type explainNode struct {
+	plan    planNode
+	analyze bool
+}
+
+// joinNode joins every row of the left input with every row of the right
+// input for which the condition is true.
+type joinNode struct {
+	left, right planNode
+	cond        expression
+}
+
+// filterNode keeps the rows for which the condition is true.
+type filterNode struct {
+	input planNode
+	cond  expression
+}
+
+// aggregateNode folds the rows into groups by the key expressions and
+// computes the aggregates of every group.
+type aggregateNode struct {
+	input   planNode
+	groupBy []expression
+	aggs    []*aggregate
+}
+
+// sortNode orders the groups.
+type sortNode struct {
+	input   planNode
+	orderBy []orderspec
+}
+
+// topNode passes the first n groups in the order of the order specs.
+type topNode struct {
+	input   planNode
+	orderBy []orderspec
+	n       int
+}
+
+// limitNode passes at most n groups.
+type limitNode struct {
+	input planNode
+	n     int
+}
+
+// gatherNode reads the table of the scan at the bottom of its input in parts,
+// each part on one of the workers running the input's filters, and passes
+// the rows in the order of the parts. An aggregation over a gather folds
+// every part into partial groups on the workers.
+type gatherNode struct {
+	input   planNode
+	workers int
+}
+
+// projectNode evaluates the selectors on every group.
+type projectNode struct {
+	input     planNode
+	selectors []selector
+}
+
+func (n *scanNode) children() []planNode      { return nil }
+func (n *valuesNode) children() []planNode    { return nil }
+func (n *explainNode) children() []planNode   { return nil }
+func (n *joinNode) children() []planNode      { return []planNode{n.left, n.right} }
+func (n *filterNode) children() []planNode    { return []planNode{n.input} }
+func (n *aggregateNode) children() []planNode { return []planNode{n.input} }
+func (n *sortNode) children() []planNode      { return []planNode{n.input} }
+func (n *topNode) children() []planNode       { return []planNode{n.input} }
+func (n *limitNode) children() []planNode     { return []planNode{n.input} }
+func (n *gatherNode) children() []planNode    { return []planNode{n.input} }
+func (n *projectNode) children() []planNode   { return []planNode{n.input} }
+
+func (n *scanNode) String() string {
+	r := "Scan " + n.name
+	if n.pushed != nil {
+		r += " where " + n.pushed.String()
+	}
+	if n.columns != nil && len(n.columns) == 0 {
+		return r + ": no columns"
+	}
+	if n.columns != nil {
+		return r + ": " + strings.Join(n.columns, ", ")
+	}
+	return r
+}
+
+func (n *gatherNode) String() string {
+	return fmt.Sprintf("Gather: %d workers", n.workers)
+}
+
+func (n *valuesNode) String() string {
+	return "Values " + n.name
+}
+
+func (n *explainNode) String() string {
+	if n.analyze {
+		return "Explain analyze"
+	}
+	return "Explain"
+}
+
+func (n *joinNode) String() string {
+	return "Join on " + n.cond.String()
+}
+
+func (n *filterNode) String() string {
+	return "Filter " + n.cond.String()
+}
+
+func (n *aggregateNode) String() string {
+	aggs := make([]string, len(n.aggs))
+	for i, a := range n.aggs {
+		aggs[i] = a.String()
+	}
+	if len(n.groupBy) == 0 {
+		return "Aggregate " + strings.Join(aggs, ", ")
+	}
+	keys := make([]string, len(n.groupBy))
+	for i, g := range n.groupBy {
+		keys[i] = g.String()
+	}
+	if len(aggs) == 0 {
+		return "Aggregate by " + strings.Join(keys, ", ")
+	}
+	return "Aggregate by " + strings.Join(keys, ", ") + ": " + strings.Join(aggs, ", ")
+}
+
+func (n *sortNode) String() string {
+	return "Sort " + formatOrder(n.orderBy)
+}
+
+func (n *topNode) String() string {
+	return fmt.Sprintf("Top %d by %s", n.n, formatOrder(n.orderBy))
+}
+
+func formatOrder(orderBy []orderspec) string {
+	specs := make([]string, len(orderBy))
+	for i, o := range orderBy {
+		specs[i] = o.expr.String()
+		if o.desc {
+			specs[i] += " DESC"
+		}
+	}
+	return strings.Join(specs, ", ")
+}
+
+func (n *limitNode) String() string {
+	return fmt.Sprintf("Limit %d", n.n)
+}
+
+func (n *projectNode) String() string {
+	selectors := make([]string, len(n.selectors))
+	for i, s := range n.selectors {
+		selectors[i] = s.Expr.String()
+		if s.Alias != "" {
+			selectors[i] += " AS " + s.Alias
+		}
+	}
+	return "Project " + strings.Join(selectors, ", ")
+}
+
+// plan builds the logical plan of a bound query. The operators follow the
+// logical order of the query's clauses.
+func (e Engine) plan(Q Query) (planNode, error) {
+	var input planNode
+	switch v := Q.From.(type) {
+	case nil:
+		// Empty FROM
+		input = &valuesNode{"(empty)", []Row{{}}}
+	case *tableName:
+		table, err := findTable(e, v.Name)
+		if err != nil {
+			return nil, err
+		}
+		input = &scanNode{name: v.Name, table: table}
+	case *describe:
+		table, err := findTable(e, v.Table)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := describeTable(table)
+		if err != nil {
+			return nil, err
+		}
+		input = &valuesNode{v.String(), rows}
+	case *explain:
+		p, err := e.plan(v.Query)
+		if err != nil {
+			return nil, err
+		}
+		input = &explainNode{e.optimize(p), v.Analyze}
+	case *Query:
+		var err error
+		input, err = e.plan(*v)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unhandled from type: %v", reflect.TypeOf(Q.From))
+	}
+
+	for _, j := range Q.Joins {
+		table, ok := e.tables[j.Table.Name]
+		if !ok {
+			return nil, fmt.Errorf("table not found: %s", j.Table.Name)
+		}
+		input = &joinNode{input, &scanNode{name: j.Table.Name, table: table}, j.Condition}
+	}
+	if Q.Filter != nil {
+		input = &filterNode{input, Q.Filter}
+	}
+	// Without the aggregation, every row is a group of its own so that the
+	// following operators work uniformly.
+	if aggs := findAggregates(Q); len(Q.GroupBy) > 0 || len(aggs) > 0 {
+		input = &aggregateNode{input, Q.GroupBy, aggs}
+	}
+	if len(Q.OrderBy) > 0 {
+		input = &sortNode{input, Q.OrderBy}
+	}
+	if Q.Limit.Set {
+		input = &limitNode{input, Q.Limit.Value}
+	}
+	return &projectNode{input, Q.Selectors}, nil
+}
+
+// nodeStats are the execution statistics of a plan node. The time includes
+// the time spent in the node's inputs.
+type nodeStats struct {
+	rows   int
+	time   time.Duration
+	memory memoryUsage
+}
+
+// memoryUsage counts the bytes of the rows an operator holds, such as the
+// rows of a sort or the groups of an aggregation, and their peak. A nil
+// usage counts nothing.
+type memoryUsage struct {
+	held, peak int64
+}
+
+// add adds n bytes to the held ones, or releases them if n is negative.
+func (m *memoryUsage) add(n int64) {
+	if m == nil {
+		return
+	}
+	m.held += n
+	if m.held > m.peak {
+		m.peak = m.held
+	}
+}
+
+// current returns the number of bytes held.
+func (m *memoryUsage) current() int64 {
+	if m == nil {
+		return 0
+	}
+	return m.held
+}
+
+// run returns the stream of the node's output. If stats is not nil, the
+// node and its inputs record their statistics in it.
+func (e Engine) run(ctx context.Context, n planNode, stats map[planNode]*nodeStats) (*Stream[group], error) {
+	if stats == nil {
+		return e.runNode(ctx, n, nil, nil)
+	}
+	st := &nodeStats{}
+	stats[n] = st
+	s, err := e.runNode(ctx, n, stats, &st.memory)
+	if err != nil {
+		return nil, err
+	}
+	return measured(s, st), nil
+}
+
+// runNode returns the stream of the node's output. The operators that hold
+// rows count their bytes in mem.
+func (e Engine) runNode(ctx context.Context, n planNode, stats map[planNode]*nodeStats, mem *memoryUsage) (*Stream[group], error) {
+	switch v := n.(type) {
+	case *scanNode:
+		next, close := e.tableRows(v.name, v.table, v.filter, v.columns)
+		return e.scanRows(ctx, v, v.table, next, close), nil
+
+	case *valuesNode:
+		groups := make([]group, len(v.rows))
+		for i, r := range v.rows {
+			groups[i] = group{row: r}
+		}
+		return arrstream(groups), nil
+
+	case *explainNode:
+		rows, err := e.explainRows(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		return arrstream(rows), nil
+
+	case *joinNode:
+		left, err := e.run(ctx, v.left, stats)
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.run(ctx, v.right, stats)
+		if err != nil {
+			left.Close()
+			return nil, err
+		}
+		// The join holds the rows of the right input.
+		if mem != nil {
+			right = mapStream(right, func(g group) (group, error) {
+				mem.add(rowSize(g.row))
+				return g, nil
+			})
+		}
+		return cancelable(ctx, joinTables(left, right)).filter(func(g group) (bool, error) {
+			return e.evalCondition(v.cond, g.row)
+		}), nil
+
+	case *filterNode:
+		input, err := e.run(ctx, v.input, stats)
+		if err != nil {
+			return nil, err
+		}
+		return input.filter(func(g group) (bool, error) {
+			return e.evalCondition(v.cond, g.row)
+		}), nil
+
+	case *aggregateNode:
+		// Spilling groups to files is done on one goroutine.
+		if g, ok := v.input.(*gatherNode); ok && e.memoryLimit == 0 {
+			return e.gatherGroups(ctx, g, v.groupBy, v.aggs, stats, mem)
+		}
+		input, err := e.run(ctx, v.input, stats)
+		if err != nil {
+			return nil, err
+		}
+		s, err := e.groupRows(ctx, input, v.groupBy, v.aggs, mem)
+		if err != nil {
+			input.Close()
+		}
+		return s, err
+
+	case *sortNode:
+		input, err := e.run(ctx, v.input, stats)
+		if err != nil {
+			return nil, err
+		}
+		return e.orderRows(ctx, input, v.orderBy, mem), nil
+
+	case *topNode:
+		input, err := e.run(ctx, v.input, stats)
+		if err != nil {
+			return nil, err
+		}
+		return e.topRows(input, v.orderBy, v.n, mem), nil
+
+	case *limitNode:
+		input, err := e.run(ctx, v.input, stats)
+		if err != nil {
+			return nil, err
+		}
+		return input.limit(v.n), nil
+
+	case *gatherNode:
+		return e.gather(ctx, v, stats)
+
+	case *projectNode:
+		input, err := e.run(ctx, v.input, stats)
+		if err != nil {
+			return nil, err
+		}
+		return e.project(input, v.selectors), nil
+	}
+	return nil, fmt.Errorf("unhandled plan node: %v", reflect.TypeOf(n))
+}
+
+// scanRows returns the stream of the rows that the functions read from the
+// table, with only the columns the scan needs.
+func (e Engine) scanRows(ctx context.Context, n *scanNode, table Table, next func() (map[string]Value, error), close func() error) *Stream[group] {
+	rows := tablestream(n.name, table, next, close)
+	keep := columnNames(n.columns)
+	return cancelable(ctx, mapStream(rows, func(r Row) (group, error) {
+		if n.columns == nil {
+			return group{row: r}, nil
+		}
+		pruned := make(Row, 0, len(n.columns))
+		for _, c := range r {
+			if keep[strings.ToLower(c.Name)] {
+				pruned = append(pruned, c)
+			}
+		}
+		return group{row: pruned}, nil
+	}))
+}
+
+// measured returns the stream that records the rows it passes and the time
+// spent in its Next in the node's stats.
+func measured(s *Stream[group], st *nodeStats) *Stream[group] {
+	return &Stream[group]{
+		s.name,
+		func() (group, bool, error) {
+			start := time.Now()
+			g, done, err := s.Next()
+			st.time += time.Since(start)
+			if !done && err == nil {
+				st.rows++
+			}
+			return g, done, err
+		},
+		s.Close,
+	}
+}
+
+// explainRows returns the description of the plan with a row for each
+// node. With analyze, it runs the plan to the end first and adds the rows
+// each node returned, the time spent in the node itself without its inputs
+// and the peak memory of the rows the node held.
+func (e Engine) explainRows(ctx context.Context, n *explainNode) ([]group, error) {
+	var stats map[planNode]*nodeStats
+	if n.analyze {
+		stats = map[planNode]*nodeStats{}
+		s, err := e.run(ctx, n.plan, stats)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			_, done, err := s.Next()
+			if err != nil {
+				s.Close()
+				return nil, err
+			}
+			if done {
+				break
+			}
+		}
+		if err := s.Close(); err != nil {
+			return nil, err
+		}
+	}
+	var rows []group
+	var add func(n planNode, depth int)
+	add = func(n planNode, depth int) {
+		line := strings.Repeat("  ", depth) + n.String()
+		if st, ok := stats[n]; ok {
+			self := st.time
+			// The time of the nodes under a gather is summed over its
+			// workers, which run alongside it.
+			if _, ok := n.(*gatherNode); !ok {
+				for _, c := range n.children() {
+					if cst, ok := stats[c]; ok {
+						self -= cst.time
+					}
+				}
+			}
+			if self < 0 {
+				self = 0
+			}
+			line += fmt.Sprintf(" (rows=%d time=%s memory=%s)", st.rows, self, formatBytes(uint64(st.memory.peak)))
+		}
+		rows = append(rows, group{row: Row{{Name: "plan", Data: Value{String, line}}}})
+		for _, c := range n.children() {
+			add(c, depth+1)
+		}
+	}
+	add(n.plan, 0)
+	return rows, nil
+}
+
+// formatBytes returns the size with a binary unit suffix.
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,84 @@
+package sql
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func planLines(t *testing.T, e Engine, query string) []string {
+	t.Helper()
+	rows, err := e.ExecString(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, r := range rows {
+		lines = append(lines, r[0].Data.Data.(string))
+	}
+	return lines
+}
+
+func TestExplain(t *testing.T) {
+	e := New(map[string]Table{
+		"t": dummy{
+			{"id": Value{Int, 1}, "name": Value{String, "a"}},
+			{"id": Value{Int, 2}, "name": Value{String, "b"}},
+		},
+		"u": dummy{
+			{"tid": Value{Int, 1}},
+		},
+	})
+	got := planLines(t, e, `explain select name, count(*) as n from t join u on t.id = u.tid where name = 'a' group by name order by name desc limit 5`)
+	want := []string{
+		`Project "name", count(*) AS n`,
+		`  Top 5 by "name" DESC`,
+		`    Aggregate by "name": count(*)`,
+		`      Join on "t"."id" = "u"."tid"`,
+		`        Filter "name" = a`,
+		`          Scan t: id, name`,
+		`        Scan u: tid`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestExplainAnalyze(t *testing.T) {
+	e := New(map[string]Table{
+		"t": dummy{
+			{"x": Value{Int, 1}},
+			{"x": Value{Int, 2}},
+			{"x": Value{Int, 2}},
+		},
+	})
+	stats := regexp.MustCompile(` time=\S+ memory=\S+\)$`)
+	var got []string
+	for _, line := range planLines(t, e, `explain analyze select x from t where x = 2 limit 1`) {
+		got = append(got, stats.ReplaceAllString(line, ")"))
+	}
+	want := []string{
+		`Project "x" (rows=1)`,
+		`  Limit 1 (rows=1)`,
+		`    Filter "x" = 2 (rows=1)`,
+		`      Scan t: x (rows=2)`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+
+	// Only the operators that hold rows report memory.
+	memory := regexp.MustCompile(`^\s*(\w+).* memory=(\S+)\)$`)
+	held := map[string]bool{}
+	for _, line := range planLines(t, e, `explain analyze select x from t order by x`) {
+		m := memory.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("no stats in %q", line)
+		}
+		held[m[1]] = m[2] != "0B"
+	}
+	if diff := cmp.Diff(map[string]bool{"Project": false, "Sort": true, "Scan": false}, held); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,171 @@
+package sql
+
+import (
+	"fmt"
+)
+
+// Stmt is a parsed query with parameters that can be executed many times
+// with different parameter values.
+type Stmt struct {
+	e Engine
+	q Query
+
+	// types are the types of the values the parameters are compared with,
+	// by the parameters' labels.
+	types map[string]ValueTypeID
+}
+
+// NamedArg is a value for a named parameter such as :name.
+type NamedArg struct {
+	Name  string
+	Value any
+}
+
+// Named returns a value for the named parameter.
+func Named(name string, value any) NamedArg {
+	return NamedArg{name, value}
+}
+
+// Prepare parses and checks the query for later execution. The query may
+// contain positional parameters written as ? or $1, $2 and so on, and named
+// parameters written as :name. ? and $n can't be mixed in one query. A
+// parameter compared with a value of a known type takes only values of that
+// type.
+func (e Engine) Prepare(sql string) (*Stmt, error) {
+	q, err := e.Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	numbered := false
+	questions := false
+	err = traverse(&q, func(x any) error {
+		p, ok := x.(*placeholder)
+		if !ok {
+			return nil
+		}
+		switch p.Text[0] {
+		case '?':
+			questions = true
+		case '$':
+			numbered = true
+		}
+		if numbered && questions {
+			return fmt.Errorf("can't mix ? and $n parameters in one query")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	bound, _, err := e.bindQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	types := map[string]ValueTypeID{}
+	err = traverse(&bound, func(x any) error {
+		p, ok := x.(*placeholder)
+		if !ok || p.Type == Any {
+			return nil
+		}
+		if t, ok := types[p.label()]; ok && !comparableTypes(t, p.Type) {
+			return fmt.Errorf("parameter %s is compared with %s and %s", p.label(), getTypeName(t), getTypeName(p.Type))
+		}
+		types[p.label()] = p.Type
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{e, q, types}, nil
+}
+
+// label names the parameter in errors: by its number or by its name with
+// the colon.
+func (p *placeholder) label() string {
+	if p.Name != "" {
+		return ":" + p.Name
+	}
+	return fmt.Sprint(p.Index)
+}
+
+// comparableTypes tells whether values of the types can be compared.
+func comparableTypes(a, b ValueTypeID) bool {
+	numeric := (a == Int || a == Double) && (b == Int || b == Double)
+	return a == b || numeric
+}
+
+// Exec binds the arguments to the statement's parameters, executes it and
+// returns the results. Positional parameters take plain arguments in order,
+// named parameters take NamedArg arguments.
+func (s *Stmt) Exec(args ...any) ([]Row, error) {
+	q, err := s.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.e.Exec(q)
+	if err != nil {
+		return nil, err
+	}
+	return r.Consume()
+}
+
+func (s *Stmt) bind(args []any) (Query, error) {
+	var positional []Value
+	named := map[string]Value{}
+	for _, arg := range args {
+		if n, ok := arg.(NamedArg); ok {
+			v, err := valueOf(n.Value)
+			if err != nil {
+				return Query{}, fmt.Errorf("parameter :%s: %w", n.Name, err)
+			}
+			named[n.Name] = v
+			continue
+		}
+		v, err := valueOf(arg)
+		if err != nil {
+			return Query{}, fmt.Errorf("parameter %d: %w", len(positional)+1, err)
+		}
+		positional = append(positional, v)
+	}
+
+	used := make([]bool, len(positional))
+	usedNames := map[string]bool{}
+	q, err := transformQuery(s.q, func(x expression) (expression, error) {
+		p, ok := x.(*placeholder)
+		if !ok {
+			return x, nil
+		}
+		var v Value
+		if p.Name != "" {
+			v, ok = named[p.Name]
+			if !ok {
+				return nil, fmt.Errorf("missing value for parameter %s", p)
+			}
+			usedNames[p.Name] = true
+		} else {
+			if p.Index > len(positional) {
+				return nil, fmt.Errorf("missing value for parameter %s", p)
+			}
+			used[p.Index-1] = true
+			v = positional[p.Index-1]
+		}
+		if t, ok := s.types[p.label()]; ok && v.Data != nil && !comparableTypes(t, v.Type) {
+			return nil, fmt.Errorf("parameter %s: expected %s, got %s", p.label(), getTypeName(t), getTypeName(v.Type))
+		}
+		return &v, nil
+	})
+	if err != nil {
+		return Query{}, err
+	}
+	for i, u := range used {
+		if !u {
+			return Query{}, fmt.Errorf("argument %d doesn't match any parameter", i+1)
+		}
+	}
+	for name := range named {
+		if !usedNames[name] {
+			return Query{}, fmt.Errorf("argument :%s doesn't match any parameter", name)
+		}
+	}
+	return q, nil
+}
@@ -0,0 +1,73 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPrepare(t *testing.T) {
+	engine := New(map[string]Table{
+		"t1": dummy{
+			{"id": Value{Int, 1}, "name": Value{String, "one"}},
+			{"id": Value{Int, 2}, "name": Value{String, "it's"}},
+			{"id": Value{Int, 3}, "name": Value{String, "three"}},
+		},
+	})
+	cases := []struct {
+		query string
+		args  []any
+		want  []map[string]any
+	}{
+		{`select id from t1 where name = ?`, []any{"it's"}, []map[string]any{{`"id"`: 2}}},
+		{`select id from t1 where id = $2 or id = $1`, []any{1, 3}, []map[string]any{{`"id"`: 1}, {`"id"`: 3}}},
+		{`select id from t1 where name = :name`, []any{Named("name", "three")}, []map[string]any{{`"id"`: 3}}},
+		{`select id from t1 where name = 'it''s'`, nil, []map[string]any{{`"id"`: 2}}},
+		{`select id from t1 where name = ?`, []any{[]byte("three")}, []map[string]any{{`"id"`: 3}}},
+		{`select id from t1 where id = ?`, []any{2.0}, []map[string]any{{`"id"`: 2}}},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			s, err := engine.Prepare(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := s.Exec(c.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(rowsAsJSON(r), c.want); diff != "" {
+				t.Fatalf("%s", diff)
+			}
+		})
+	}
+
+	errors := []struct {
+		query string
+		args  []any
+		err   string
+	}{
+		{`select id from t1 where id = ?`, nil, "missing value for parameter ?"},
+		{`select id from t1 where id = ?`, []any{1, 2}, "argument 2 doesn't match any parameter"},
+		{`select id from t1 where id = ?`, []any{struct{}{}}, "parameter 1: unsupported parameter type: struct {}"},
+		{`select id from t1 where id = ? or id = $1`, []any{1}, "can't mix ? and $n parameters in one query"},
+		{`select id from t1 where id = ?`, []any{uint64(1 << 63)}, "parameter 1: 9223372036854775808 overflows Int"},
+		{`select id from t1 where id = :id`, []any{Named("id", 1), Named("name", "one")}, "argument :name doesn't match any parameter"},
+		{`select id from t1 where id = ?`, []any{"one"}, "parameter 1: expected Int, got String"},
+		{`select id from t1 where id = :x or name = :x`, []any{Named("x", 1)}, "parameter :x is compared with Int and String"},
+	}
+	for _, c := range errors {
+		t.Run(c.query, func(t *testing.T) {
+			s, err := engine.Prepare(c.query)
+			if err == nil {
+				_, err = s.Exec(c.args...)
+			}
+			if err == nil {
+				t.Fatalf("expected an error, got nil")
+			}
+			if diff := cmp.Diff(c.err, err.Error()); diff != "" {
+				t.Fatalf("%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package sql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// keyedTable is a table of values by key that looks up keys instead of
+// scanning when the query asks for a key.
+type keyedTable struct {
+	values map[string]int
+
+	// lookup is the key to return, if set.
+	lookup *string
+
+	// columns are the columns asked for by the last query.
+	columns *[]string
+}
+
+func (t keyedTable) Columns() ([]Column, error) {
+	return []Column{{"k", String, false}, {"v", Int, false}}, nil
+}
+
+func (t keyedTable) GetRows() func() (map[string]Value, error) {
+	return t.GetRowsWithColumns([]string{"k", "v"})
+}
+
+func (t keyedTable) GetRowsWithColumns(columns []string) func() (map[string]Value, error) {
+	*t.columns = columns
+	var keys []string
+	if t.lookup != nil {
+		if _, ok := t.values[*t.lookup]; ok {
+			keys = []string{*t.lookup}
+		}
+	} else {
+		for k := range t.values {
+			keys = append(keys, k)
+		}
+	}
+	return func() (map[string]Value, error) {
+		if len(keys) == 0 {
+			return nil, nil
+		}
+		k := keys[0]
+		keys = keys[1:]
+		return map[string]Value{"k": {String, k}, "v": {Int, t.values[k]}}, nil
+	}
+}
+
+func (t keyedTable) PushFilter(filter []Comparison) (Table, []Comparison) {
+	var residual []Comparison
+	for _, c := range filter {
+		if c.Column == "k" && c.Op == "=" && c.Value.Type == String && t.lookup == nil {
+			k := c.Value.Data.(string)
+			t.lookup = &k
+			continue
+		}
+		residual = append(residual, c)
+	}
+	return t, residual
+}
+
+func TestPushdown(t *testing.T) {
+	cases := []struct {
+		query   string
+		plan    string
+		columns []string
+		rows    []map[string]any
+	}{
+		{
+			`select v from t where k = 'b'`,
+			`Scan t where "k" = b: v`,
+			[]string{"v"},
+			[]map[string]any{{`"v"`: 2}},
+		},
+		{
+			`select k from t where v > 1 and 'c' = k`,
+			`Scan t where c = "k": k, v`,
+			[]string{"k", "v"},
+			[]map[string]any{{`"k"`: "c"}},
+		},
+		{
+			`select k from t where k = 'a' and v > 1`,
+			`Scan t where "k" = a: k, v`,
+			[]string{"k", "v"},
+			nil,
+		},
+		{
+			`select v from t where k = 'x'`,
+			`Scan t where "k" = x: v`,
+			[]string{"v"},
+			nil,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			var columns []string
+			e := New(map[string]Table{
+				"t": keyedTable{values: map[string]int{"a": 1, "b": 2, "c": 3}, columns: &columns},
+			})
+			plan := planLines(t, e, "explain "+c.query)
+			if got := strings.TrimSpace(plan[len(plan)-1]); got != c.plan {
+				t.Errorf("got scan %q, want %q", got, c.plan)
+			}
+			rows, err := e.ExecString(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(c.rows, rowsAsJSON(rows)); diff != "" {
+				t.Error(diff)
+			}
+			if diff := cmp.Diff(c.columns, columns); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestProjectedSources(t *testing.T) {
+	csv := "a,b\n1,x\n2,y\n"
+	json := `{"a": 1, "b": "x"} {"a": 2, "b": "y"}`
+	for name, table := range map[string]Table{
+		"csv":  CsvStream(strings.NewReader(csv), CsvOptions{}),
+		"json": JsonStream(strings.NewReader(json), JsonOptions{}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			next := table.(ProjectableTable).GetRowsWithColumns([]string{"A"})
+			var got []map[string]Value
+			for {
+				row, err := next()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if row == nil {
+					break
+				}
+				got = append(got, row)
+			}
+			want := []map[string]Value{{"a": {Int, 1}}, {"a": {Int, 2}}}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
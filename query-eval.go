@@ -7,46 +7,103 @@ import (
 	"strings"
 )
 
-func eval(node any, row Row, group []Row) (Value, error) {
-	switch e := node.(type) {
+// EvalError is an error in evaluating an expression on a row.
+type EvalError struct {
+	// Expr is the expression that failed.
+	Expr string
+
+	// Row is the row the expression was evaluated on.
+	Row Row
+
+	Err error
+}
+
+func (e *EvalError) Error() string {
+	return fmt.Sprintf("%s: %s, in %s", e.Expr, e.Err, e.Row)
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// evalOn evaluates the expression on the row and attaches the expression and
+// the row to the error.
+func (e Engine) evalOn(expr expression, row Row, aggs map[*aggregate]Value) (Value, error) {
+	v, err := e.eval(expr, row, aggs)
+	if err != nil {
+		return v, &EvalError{expr.String(), row, err}
+	}
+	return v, nil
+}
+
+// evalCondition evaluates a boolean condition on the row. NULL counts as
+// false.
+func (e Engine) evalCondition(expr expression, row Row) (bool, error) {
+	v, err := e.evalOn(expr, row, nil)
+	if err != nil {
+		return false, err
+	}
+	if v.Data == nil {
+		return false, nil
+	}
+	b, ok := v.Data.(bool)
+	if !ok {
+		return false, &EvalError{expr.String(), row, fmt.Errorf("condition is %s, not Bool", getTypeName(v.Type))}
+	}
+	return b, nil
+}
+
+func (e Engine) eval(node any, row Row, aggs map[*aggregate]Value) (Value, error) {
+	switch n := node.(type) {
 	case *Value:
-		return *e, nil
+		return *n, nil
 
 	case *columnRef:
-		return evalColumnRef(e, row, group)
+		return evalColumnRef(n, row)
 
 	case *aggregate:
-		switch strings.ToLower(e.Name) {
-		case "count":
-			return evalCount(e.Args, group)
-		case "min":
-			return evalMin(e.Args, group)
+		v, ok := aggs[n]
+		if !ok {
+			return Value{}, fmt.Errorf("aggregate %s is not computed in this context", n)
 		}
-		return Value{}, fmt.Errorf("unknown aggregate: %s", e.Name)
+		return v, nil
 
 	case *functionkek:
-		return evalFunction(e, row, group)
+		return e.evalFunction(n, row, aggs)
 
 	case *binaryOperatorNode:
-		return evalBinaryOp(e, row, group)
+		return e.evalBinaryOp(n, row, aggs)
 
 	case *fbinaryOr:
-		return evalBinaryOr(e, row, group)
+		return e.evalBinaryOr(n, row, aggs)
+
+	case *fbinaryAnd:
+		return e.evalBinaryAnd(n, row, aggs)
+
+	case *placeholder:
+		return Value{}, fmt.Errorf("unbound parameter %s", n)
 
 	default:
-		panic(fmt.Sprintf("unknown node in eval: %v", reflect.TypeOf(node)))
+		return Value{}, fmt.Errorf("can't evaluate %v", reflect.TypeOf(node))
 	}
 }
 
-func evalBinaryOp(v *binaryOperatorNode, x Row, rows []Row) (Value, error) {
-	a, err := eval(v.left, x, rows)
+func (e Engine) evalBinaryOp(v *binaryOperatorNode, x Row, aggs map[*aggregate]Value) (Value, error) {
+	a, err := e.eval(v.left, x, aggs)
 	if err != nil {
 		return Value{}, err
 	}
-	b, err := eval(v.right, x, rows)
+	b, err := e.eval(v.right, x, aggs)
 	if err != nil {
 		return Value{}, err
 	}
+	// A comparison with NULL is NULL.
+	if a.Data == nil || b.Data == nil {
+		switch v.op {
+		case "=", ">", "<":
+			return Value{Bool, nil}, nil
+		}
+	}
 	var r bool
 	switch v.op {
 	case "=":
@@ -61,28 +118,61 @@ func evalBinaryOp(v *binaryOperatorNode, x Row, rows []Row) (Value, error) {
 	return Value{Bool, r}, err
 }
 
-func evalBinaryOr(e *fbinaryOr, x Row, group []Row) (Value, error) {
-	a, err := eval(e.left, x, group)
+func (e Engine) evalBinaryOr(v *fbinaryOr, x Row, aggs map[*aggregate]Value) (Value, error) {
+	a, err := e.eval(v.left, x, aggs)
+	if err != nil {
+		return Value{}, err
+	}
+	if a.Type != Bool {
+		return Value{}, errors.New("left-hand side does not evaluate to bool: " + v.left.String())
+	}
+	if a.Data == true {
+		return a, nil
+	}
+	b, err := e.eval(v.right, x, aggs)
+	if err != nil {
+		return Value{}, err
+	}
+	if b.Type != Bool {
+		return Value{}, errors.New("right-hand side does not evaluate to bool: " + v.right.String())
+	}
+	// NULL or false is NULL.
+	if a.Data == nil && b.Data == false {
+		return a, nil
+	}
+	return b, nil
+}
+
+func (e Engine) evalBinaryAnd(v *fbinaryAnd, x Row, aggs map[*aggregate]Value) (Value, error) {
+	a, err := e.eval(v.left, x, aggs)
 	if err != nil {
 		return Value{}, err
 	}
 	if a.Type != Bool {
-		return Value{}, errors.New("left-hand side does not evaluate to bool: " + e.left.String())
+		return Value{}, errors.New("left-hand side does not evaluate to bool: " + v.left.String())
 	}
-	if a.Data.(bool) {
+	if a.Data == false {
 		return a, nil
 	}
-	b, err := eval(e.right, x, group)
+	b, err := e.eval(v.right, x, aggs)
 	if err != nil {
 		return Value{}, err
 	}
 	if b.Type != Bool {
-		return Value{}, errors.New("right-hand side does not evaluate to bool: " + e.right.String())
+		return Value{}, errors.New("right-hand side does not evaluate to bool: " + v.right.String())
+	}
+	// NULL and true is NULL.
+	if a.Data == nil && b.Data == true {
+		return a, nil
 	}
 	return b, nil
 }
 
-func evalColumnRef(e *columnRef, x Row, group []Row) (Value, error) {
+// evalColumnRef returns the value of the referenced column. A qualified
+// reference a.b that doesn't match a column of table a refers to the column
+// named "a.b", such as one made from a nested JSON object. An optional
+// column missing from the row is NULL.
+func evalColumnRef(e *columnRef, x Row) (Value, error) {
 	for _, cell := range x {
 		if e.Table != "" && !strings.EqualFold(e.Table, cell.TableName) {
 			continue
@@ -92,10 +182,18 @@ func evalColumnRef(e *columnRef, x Row, group []Row) (Value, error) {
 		}
 		return cell.Data, nil
 	}
+	if e.Table != "" {
+		if v, err := evalColumnRef(&columnRef{Column: e.Table + "." + e.Column}, x); err == nil {
+			return v, nil
+		}
+	}
+	if e.Optional {
+		return Value{e.Type, nil}, nil
+	}
 	return Value{}, fmt.Errorf("couldn't find %s in a row", e)
 }
 
-func evalFunction(f *functionkek, r Row, group []Row) (Value, error) {
+func (e Engine) evalFunction(f *functionkek, r Row, aggs map[*aggregate]Value) (Value, error) {
 	if strings.ToLower(f.Name) == "cast" {
 		if len(f.Args) != 1 {
 			return Value{}, fmt.Errorf("cast expects one argument, got %d", len(f.Args))
@@ -104,7 +202,7 @@ func evalFunction(f *functionkek, r Row, group []Row) (Value, error) {
 		if !ok {
 			return Value{}, fmt.Errorf("cast expects an AS argument, got %s", f.Args[0].String())
 		}
-		val, err := eval(v.Expr, r, group)
+		val, err := e.eval(v.Expr, r, aggs)
 		if err != nil {
 			return Value{}, err
 		}
@@ -112,51 +210,14 @@ func evalFunction(f *functionkek, r Row, group []Row) (Value, error) {
 	}
 	args := make([]Value, len(f.Args))
 	for i, argExpression := range f.Args {
-		exprResult, err := eval(argExpression, r, group)
+		exprResult, err := e.eval(argExpression, r, aggs)
 		if err != nil {
 			return exprResult, err
 		}
 		args[i] = exprResult
 	}
-	return function(f.Name, args)
-}
-
-func evalCount(args []expression, rows []Row) (Value, error) {
-	if len(args) != 1 {
-		return Value{}, fmt.Errorf("unimplemented arguments variant for count: %s", args)
-	}
-	if _, ok := args[0].(*star); !ok {
-		return Value{}, fmt.Errorf("unimplemented arguments variant for count: %s", args)
+	if fn, ok := e.functions[strings.ToLower(f.Name)]; ok {
+		return fn.call(args)
 	}
-	return Value{Int, len(rows)}, nil
-}
-
-func evalMin(args []expression, rows []Row) (Value, error) {
-	if len(args) != 1 {
-		return Value{}, fmt.Errorf("unimplemented arguments variant for min: %s", args)
-	}
-	min := Value{Int, nil}
-	for i, row := range rows {
-		v, err := eval(args[0], row, rows)
-		if err != nil {
-			return Value{}, err
-		}
-		if i == 0 {
-			min = v
-			continue
-		}
-		less, err := v.lessThan(min)
-		if err != nil {
-			return Value{}, err
-		}
-		if less {
-			min = v
-		}
-	}
-	return min, nil
-}
-
-func isAggregate(name string) bool {
-	n := strings.ToLower(name)
-	return n == "count" || n == "min"
+	return function(f.Name, args)
 }
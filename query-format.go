@@ -2,7 +2,6 @@ package sql
 
 import (
 	"fmt"
-	"reflect"
 	"strings"
 )
 
@@ -10,6 +9,9 @@ func format(q Query) string {
 	r := strings.Builder{}
 
 	r.WriteString("SELECT")
+	if q.Distinct {
+		r.WriteString(" DISTINCT")
+	}
 	for i, s := range q.Selectors {
 		if i > 0 {
 			r.WriteString(",")
@@ -52,6 +54,9 @@ func FormatQuery(q Query) string {
 	r := strings.Builder{}
 
 	r.WriteString(fmt.Sprintf("%8s", "SELECT"))
+	if q.Distinct {
+		r.WriteString(" DISTINCT")
+	}
 	for i, s := range q.Selectors {
 		if i > 0 {
 			r.WriteString(",")
@@ -89,13 +94,9 @@ func FormatQuery(q Query) string {
 				r.WriteString(",")
 			}
 			r.WriteString(" ")
-			switch v := o.expr.(type) {
-			case *columnRef:
-				r.WriteString(v.String())
-			case aggregate:
-				r.WriteString(v.String())
-			default:
-				panic(fmt.Errorf("unexpected expression type in order by: %s", reflect.TypeOf(o.expr)))
+			r.WriteString(o.expr.String())
+			if o.desc {
+				r.WriteString(" DESC")
 			}
 		}
 	}
@@ -138,8 +139,12 @@ func (e fbinaryOr) String() string {
 	return fmt.Sprintf("%s OR %s", e.left.String(), e.right.String())
 }
 
+func (e fbinaryAnd) String() string {
+	return fmt.Sprintf("%s AND %s", e.left.String(), e.right.String())
+}
+
 func (e binaryOperatorNode) String() string {
-	return fmt.Sprintf("%s = %s", e.left.String(), e.right.String())
+	return fmt.Sprintf("%s %s %s", e.left.String(), e.op, e.right.String())
 }
 
 func (e columnRef) String() string {
@@ -153,6 +158,21 @@ func (t tableName) String() string {
 	return t.Name
 }
 
+func (d describe) String() string {
+	return "DESCRIBE " + d.Table
+}
+
+func (x explain) String() string {
+	if x.Analyze {
+		return "EXPLAIN ANALYZE " + format(x.Query)
+	}
+	return "EXPLAIN " + format(x.Query)
+}
+
 func (e *as) String() string {
 	return fmt.Sprintf("%s AS %s", e.Expr.String(), getTypeName(e.TypeID))
 }
+
+func (p *placeholder) String() string {
+	return p.Text
+}
@@ -2,6 +2,7 @@ package sql
 
 // Query is a syntax tree that represents a query.
 type Query struct {
+	Distinct  bool
 	From      any
 	Joins     []joinspec
 	Filter    expression
@@ -18,6 +19,18 @@ type tableName struct {
 	Name string
 }
 
+// describe is a FROM source that lists the columns of a table.
+type describe struct {
+	Table string
+}
+
+// explain is a FROM source that lists the plan of a query, with the
+// statistics of its execution if Analyze is set.
+type explain struct {
+	Query   Query
+	Analyze bool
+}
+
 type selector struct {
 	Expr  expression
 	Alias string
@@ -52,6 +65,14 @@ type functionkek struct {
 type columnRef struct {
 	Table  string
 	Column string
+
+	// Type is the column's type, set by the binder. It is Any if the type
+	// is not known before execution.
+	Type ValueTypeID
+
+	// Optional is set by the binder if the column's table may find columns
+	// as it reads. Rows without the column read it as NULL.
+	Optional bool
 }
 
 type aggregate struct {
@@ -70,6 +91,24 @@ type fbinaryOr struct {
 	right expression
 }
 
+type fbinaryAnd struct {
+	left  expression
+	right expression
+}
+
 type star struct {
 	//
 }
+
+// placeholder is a query parameter that gets its value when a prepared
+// statement is executed. Positional parameters have an index starting with 1,
+// named parameters have a name.
+type placeholder struct {
+	Text  string
+	Index int
+	Name  string
+
+	// Type is the type of the values the parameter is compared with, set
+	// by the binder. It is Any if the type is not known.
+	Type ValueTypeID
+}
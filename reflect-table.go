@@ -0,0 +1,282 @@
+package sql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// structField is a struct field mapped to a column.
+type structField struct {
+	index  []int
+	column Column
+}
+
+type reflectTable struct {
+	fields []structField
+	src    reflect.Value
+}
+
+// SliceTable returns a table with the elements of a slice of structs or
+// pointers to structs as rows. Columns are named after the exported fields
+// or their sql tags, for example `sql:"name"`. Fields tagged `sql:"-"` are
+// skipped. Nested structs and maps become JSON values, slices become arrays.
+func SliceTable(slice any) (*reflectTable, error) {
+	v := reflect.ValueOf(slice)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected a slice, got %s", reflect.TypeOf(slice))
+	}
+	fields, err := structFields(v.Type().Elem())
+	if err != nil {
+		return nil, err
+	}
+	return &reflectTable{fields, v}, nil
+}
+
+// ChanTable returns a table that reads rows from a channel of structs or
+// pointers to structs until the channel is closed. The columns are derived
+// as in SliceTable. The channel can be read only once.
+func ChanTable(ch any) (*reflectTable, error) {
+	v := reflect.ValueOf(ch)
+	if v.Kind() != reflect.Chan || v.Type().ChanDir()&reflect.RecvDir == 0 {
+		return nil, fmt.Errorf("expected a receivable channel, got %s", reflect.TypeOf(ch))
+	}
+	fields, err := structFields(v.Type().Elem())
+	if err != nil {
+		return nil, err
+	}
+	return &reflectTable{fields, v}, nil
+}
+
+func (t *reflectTable) Columns() ([]Column, error) {
+	var r []Column
+	for _, f := range t.fields {
+		r = append(r, f.column)
+	}
+	return r, nil
+}
+
+func (t *reflectTable) GetRows() func() (map[string]Value, error) {
+	i := 0
+	return func() (map[string]Value, error) {
+		var item reflect.Value
+		if t.src.Kind() == reflect.Chan {
+			x, ok := t.src.Recv()
+			if !ok {
+				return nil, nil
+			}
+			item = x
+		} else {
+			if i >= t.src.Len() {
+				return nil, nil
+			}
+			item = t.src.Index(i)
+			i++
+		}
+		for item.Kind() == reflect.Pointer {
+			if item.IsNil() {
+				return nil, fmt.Errorf("nil element in the source")
+			}
+			item = item.Elem()
+		}
+		row := map[string]Value{}
+		for _, f := range t.fields {
+			field, err := item.FieldByIndexErr(f.index)
+			if err != nil {
+				// The field is promoted through a nil pointer.
+				row[f.column.Name] = Value{f.column.Type, nil}
+				continue
+			}
+			v, err := reflectValue(field, f.column.Type)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.column.Name, err)
+			}
+			row[f.column.Name] = v
+		}
+		return row, nil
+	}
+}
+
+// structFields returns the columns for a struct type or a pointer to one.
+// As in Go, a field hides the fields with the same name promoted from
+// deeper embedded structs. Fields with the same name at the same depth are
+// an error.
+func structFields(t reflect.Type) ([]structField, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected struct elements, got %s", t)
+	}
+	fields := collectFields(t)
+	depth := map[string]int{}
+	for _, f := range fields {
+		name := strings.ToLower(f.column.Name)
+		if d, ok := depth[name]; !ok || len(f.index) < d {
+			depth[name] = len(f.index)
+		}
+	}
+	var r []structField
+	seen := map[string]bool{}
+	for _, f := range fields {
+		name := strings.ToLower(f.column.Name)
+		if len(f.index) != depth[name] {
+			continue
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate column %s in %s", f.column.Name, t)
+		}
+		seen[name] = true
+		r = append(r, f)
+	}
+	return r, nil
+}
+
+// collectFields returns the columns for the fields of a struct type,
+// including the fields promoted from embedded structs.
+func collectFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("sql")
+		name := fieldName(f)
+		if name == "-" {
+			continue
+		}
+		// Fields of embedded structs are promoted, even if the struct type
+		// is not exported, unless the field is named with a tag. Fields
+		// promoted through a pointer are NULL when the pointer is nil.
+		embedded, pointer := f.Type, false
+		if embedded.Kind() == reflect.Pointer {
+			embedded, pointer = embedded.Elem(), true
+		}
+		if f.Anonymous && tag == "" && embedded.Kind() == reflect.Struct {
+			for _, n := range collectFields(embedded) {
+				n.index = append([]int{i}, n.index...)
+				n.column.Nullable = n.column.Nullable || pointer
+				fields = append(fields, n)
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		t, nullable := goType(f.Type)
+		fields = append(fields, structField{[]int{i}, Column{name, t, nullable}})
+	}
+	return fields
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// goType returns the value type for a Go type and tells whether its values
+// can be null.
+func goType(t reflect.Type) (ValueTypeID, bool) {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		nullable = true
+		t = t.Elem()
+	}
+	if t == timeType {
+		return String, nullable
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return String, nullable
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Int, nullable
+	case reflect.Float32, reflect.Float64:
+		return Double, nullable
+	case reflect.Bool:
+		return Bool, nullable
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return String, true
+		}
+		return Array, true
+	case reflect.Array:
+		return Array, nullable
+	default:
+		return JSON, true
+	}
+}
+
+// reflectValue converts a Go value to a Value of the given type.
+func reflectValue(v reflect.Value, t ValueTypeID) (Value, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return Value{t, nil}, nil
+		}
+		v = v.Elem()
+	}
+	switch t {
+	case String:
+		if v.Type() == timeType {
+			return Value{String, v.Interface().(time.Time).Format(time.RFC3339Nano)}, nil
+		}
+		if v.Kind() == reflect.Slice {
+			if v.IsNil() {
+				return Value{String, nil}, nil
+			}
+			return Value{String, string(v.Bytes())}, nil
+		}
+		return Value{String, v.String()}, nil
+	case Int:
+		if v.CanInt() {
+			return Value{Int, int(v.Int())}, nil
+		}
+		if v.Uint() > math.MaxInt {
+			return Value{}, fmt.Errorf("%d overflows Int", v.Uint())
+		}
+		return Value{Int, int(v.Uint())}, nil
+	case Double:
+		return Value{Double, v.Float()}, nil
+	case Bool:
+		return Value{Bool, v.Bool()}, nil
+	case Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return Value{Array, nil}, nil
+		}
+		items := make([]Value, v.Len())
+		for i := range items {
+			et, _ := goType(v.Type().Elem())
+			item, err := reflectValue(v.Index(i), et)
+			if err != nil {
+				return Value{}, err
+			}
+			items[i] = item
+		}
+		return Value{Array, items}, nil
+	default:
+		return toJSON(v.Interface())
+	}
+}
+
+// toJSON converts a Go value to a JSON value the way encoding/json does.
+func toJSON(x any) (Value, error) {
+	data, err := json.Marshal(x)
+	if err != nil {
+		return Value{}, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var r any
+	if err := dec.Decode(&r); err != nil {
+		return Value{}, err
+	}
+	return Value{JSON, plainJSON(r)}, nil
+}
+
+// fieldName returns the column name for a struct field, the first part of
+// its sql tag if any.
+func fieldName(f reflect.StructField) string {
+	if tag := strings.Split(f.Tag.Get("sql"), ",")[0]; tag != "" {
+		return tag
+	}
+	return f.Name
+}
@@ -0,0 +1,168 @@
+package sql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type address struct {
+	City string `json:"city"`
+}
+
+type person struct {
+	Name    string `sql:"name"`
+	Age     int    `sql:"age"`
+	Score   *float64
+	Tags    []string `sql:"tags"`
+	Address address  `sql:"address"`
+	Secret  string   `sql:"-"`
+	hidden  int
+}
+
+func TestSliceTable(t *testing.T) {
+	score := 4.5
+	people := []person{
+		{Name: "ann", Age: 30, Score: &score, Tags: []string{"a", "b"}, Address: address{"Oslo"}},
+		{Name: "bob", Age: 25},
+	}
+	table, err := SliceTable(people)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, err := table.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantColumns := []Column{
+		{"name", String, false},
+		{"age", Int, false},
+		{"Score", Double, true},
+		{"tags", Array, true},
+		{"address", JSON, true},
+	}
+	if diff := cmp.Diff(wantColumns, columns); diff != "" {
+		t.Errorf("columns: %s", diff)
+	}
+
+	engine := New(map[string]Table{"people": table})
+	r, err := engine.ExecString(`select name, Score, tags, address from people where age > 20`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]any{
+		{`"name"`: "ann", `"Score"`: 4.5, `"tags"`: []Value{{String, "a"}, {String, "b"}}, `"address"`: map[string]any{"city": "Oslo"}},
+		{`"name"`: "bob", `"Score"`: nil, `"tags"`: nil, `"address"`: map[string]any{"city": ""}},
+	}
+	if diff := cmp.Diff(want, rowsAsJSON(r)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestChanTable(t *testing.T) {
+	ch := make(chan *person, 3)
+	ch <- &person{Name: "ann", Age: 30}
+	ch <- &person{Name: "bob", Age: 25}
+	ch <- &person{Name: "cid", Age: 40}
+	close(ch)
+	table, err := ChanTable(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := New(map[string]Table{"people": table})
+	r, err := engine.ExecString(`select name from people where age > 26`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]any{{`"name"`: "ann"}, {`"name"`: "cid"}}
+	if diff := cmp.Diff(want, rowsAsJSON(r)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestSliceTableErrors(t *testing.T) {
+	if _, err := SliceTable(42); err == nil {
+		t.Error("expected an error for a non-slice")
+	}
+	if _, err := SliceTable([]int{1}); err == nil {
+		t.Error("expected an error for non-struct elements")
+	}
+	if _, err := ChanTable([]person{}); err == nil {
+		t.Error("expected an error for a non-channel")
+	}
+}
+
+type record struct {
+	ID   int    `sql:"id"`
+	Name string `sql:"name"`
+}
+
+type labeled struct {
+	record
+	Name string `sql:"name"`
+	Tag  string `sql:"tag"`
+}
+
+type linked struct {
+	*record
+	Tag string `sql:"tag"`
+}
+
+func TestEmbeddedFields(t *testing.T) {
+	table, err := SliceTable([]labeled{{record{1, "inner"}, "outer", "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(map[string]Table{"t": table}).ExecString(`select * from t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]any{{"id": 1, "name": "outer", "tag": "x"}}
+	if diff := cmp.Diff(want, rowsAsJSON(r)); diff != "" {
+		t.Error(diff)
+	}
+
+	type twice struct {
+		A string `sql:"a"`
+		B string `sql:"A"`
+	}
+	if _, err := SliceTable([]twice{}); err == nil {
+		t.Error("expected an error for duplicate columns")
+	}
+
+	table, err = SliceTable([]linked{{&record{2, "two"}, "x"}, {nil, "y"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, err := table.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantColumns := []Column{{"id", Int, true}, {"name", String, true}, {"tag", String, false}}
+	if diff := cmp.Diff(wantColumns, columns); diff != "" {
+		t.Errorf("columns: %s", diff)
+	}
+	r, err = New(map[string]Table{"t": table}).ExecString(`select * from t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []map[string]any{{"id": 2, "name": "two", "tag": "x"}, {"id": nil, "name": nil, "tag": "y"}}
+	if diff := cmp.Diff(want, rowsAsJSON(r)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestSliceTableOverflow(t *testing.T) {
+	type big struct {
+		N uint64
+	}
+	table, err := SliceTable([]big{{1 << 63}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = New(map[string]Table{"t": table}).ExecString(`select N from t`)
+	if err == nil || !strings.Contains(err.Error(), "9223372036854775808 overflows Int") {
+		t.Errorf("got %v, want an overflow error", err)
+	}
+}
@@ -0,0 +1,115 @@
+package sql
+
+import (
+	"fmt"
+)
+
+// ErrorPolicy tells a table source what to do with rows it can't read.
+type ErrorPolicy int
+
+const (
+	// FailOnError makes the query fail on the first bad row.
+	FailOnError ErrorPolicy = iota
+	// SkipOnError drops bad rows.
+	SkipOnError
+	// CollectOnError drops bad rows and keeps them for inspection.
+	CollectOnError
+)
+
+// RowError is an error in a single input row.
+type RowError struct {
+	// Row is the number of the row in the input, starting with 1.
+	Row int
+	// Line is the number of the line in the input, or 0 if the source
+	// doesn't track lines.
+	Line int
+	// Text is the raw input of the row, if available.
+	Text string
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+	}
+	return fmt.Sprintf("row %d: %s", e.Row, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// rowErrors applies an error policy to a table's bad rows.
+type rowErrors struct {
+	policy   ErrorPolicy
+	callback func(*RowError)
+	skipped  int
+	rejected []*RowError
+}
+
+// handle returns the error if it has to fail the query, or nil if the row
+// has to be skipped.
+func (r *rowErrors) handle(err *RowError) error {
+	if r.callback != nil {
+		r.callback(err)
+	}
+	switch r.policy {
+	case SkipOnError:
+		r.skipped++
+		return nil
+	case CollectOnError:
+		r.skipped++
+		r.rejected = append(r.rejected, err)
+		return nil
+	default:
+		return err
+	}
+}
+
+// Skipped returns the number of rows skipped so far.
+func (r *rowErrors) Skipped() int {
+	return r.skipped
+}
+
+// Errors returns a table of the rows rejected so far in the collect mode.
+// The table has the columns row, line, error and text.
+func (r *rowErrors) Errors() Table {
+	return &errorsTable{r}
+}
+
+type errorsTable struct {
+	r *rowErrors
+}
+
+func (t *errorsTable) Columns() ([]Column, error) {
+	return []Column{
+		{"row", Int, false},
+		{"line", Int, true},
+		{"error", String, false},
+		{"text", String, true},
+	}, nil
+}
+
+func (t *errorsTable) GetRows() func() (map[string]Value, error) {
+	i := 0
+	return func() (map[string]Value, error) {
+		if i >= len(t.r.rejected) {
+			return nil, nil
+		}
+		e := t.r.rejected[i]
+		i++
+		row := map[string]Value{
+			"row":   {Int, e.Row},
+			"line":  {Int, nil},
+			"error": {String, e.Err.Error()},
+			"text":  {String, nil},
+		}
+		if e.Line > 0 {
+			row["line"] = Value{Int, e.Line}
+		}
+		if e.Text != "" {
+			row["text"] = Value{String, e.Text}
+		}
+		return row, nil
+	}
+}
@@ -0,0 +1,82 @@
+package sql
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestErrorPolicies(t *testing.T) {
+	data := "{\"a\": 1}\n{\"a\": \n{\"a\": \"x\"}\n{\"a\": 4}\n"
+
+	table := JsonStream(strings.NewReader(data), JsonOptions{OnError: SkipOnError, SampleSize: 1})
+	engine := New(map[string]Table{"t": table})
+	r, err := engine.ExecString(`select a from t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(rowsAsJSON(r), []map[string]any{{`"a"`: 1}, {`"a"`: 4}}); diff != "" {
+		t.Fatalf("%s", diff)
+	}
+	if table.Skipped() != 2 {
+		t.Fatalf("expected 2 skipped rows, got %d", table.Skipped())
+	}
+
+	table = JsonStream(strings.NewReader(data), JsonOptions{OnError: CollectOnError, SampleSize: 1})
+	engine = New(map[string]Table{"t": table, "errors": table.Errors()})
+	if _, err := engine.ExecString(`select a from t`); err != nil {
+		t.Fatal(err)
+	}
+	r, err = engine.ExecString(`select line, text from errors`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]any{
+		{`"line"`: 2, `"text"`: `{"a": `},
+		{`"line"`: 3, `"text"`: `{"a": "x"}`},
+	}
+	if diff := cmp.Diff(rowsAsJSON(r), want); diff != "" {
+		t.Fatalf("%s", diff)
+	}
+
+	// Reading resumes after a malformed record also in input that is not
+	// newline-delimited.
+	inputs := []struct {
+		data string
+		opts JsonOptions
+	}{
+		{"{\n  \"a\": 1\n}\n{\n  \"a\": oops\n}\n{\n  \"a\": 4\n}\n", JsonOptions{}},
+		{"[\n  {\"a\": 1},\n  {\"a\": ?},\n  {\"a\": 4}\n]\n", JsonOptions{}},
+		{"{\"data\": [\n  {\"a\": 1},\n  {\"a\": 2,, \"b\": 3},\n  {\"a\": 4},\n  {\"a\": }\n]}\n", JsonOptions{RecordPath: "$.data[*]"}},
+	}
+	for _, in := range inputs {
+		in.opts.OnError = SkipOnError
+		table := JsonStream(strings.NewReader(in.data), in.opts)
+		r, err := New(map[string]Table{"t": table}).ExecString(`select a from t`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(rowsAsJSON(r), []map[string]any{{`"a"`: 1}, {`"a"`: 4}}); diff != "" {
+			t.Errorf("%q: %s", in.data, diff)
+		}
+	}
+
+	csvTable := CsvStream(strings.NewReader("a,b\n1,2\n3\n\"4,5\n"), CsvOptions{OnError: CollectOnError})
+	r, err = New(map[string]Table{"t": csvTable}).ExecString(`select a from t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(rowsAsJSON(r), []map[string]any{{`"a"`: 1}}); diff != "" {
+		t.Fatalf("%s", diff)
+	}
+	var lines []int
+	for _, e := range csvTable.rejected {
+		lines = append(lines, e.Line)
+	}
+	sort.Ints(lines)
+	if diff := cmp.Diff([]int{3, 4}, lines); diff != "" {
+		t.Fatalf("%s", diff)
+	}
+}
@@ -0,0 +1,69 @@
+package sql
+
+import "context"
+
+// Rows is the result of a query, read one row at a time.
+type Rows struct {
+	s      *Stream[Row]
+	row    Row
+	err    error
+	closed bool
+}
+
+// Query parses and executes a query and returns its rows.
+func (e Engine) Query(sql string) (*Rows, error) {
+	return e.QueryContext(context.Background(), sql)
+}
+
+// QueryContext is Query that stops the execution with the context's error
+// when the context is done.
+func (e Engine) QueryContext(ctx context.Context, sql string) (*Rows, error) {
+	q, err := e.Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	s, err := e.execContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return &Rows{s: s}, nil
+}
+
+// Next advances to the next row. It returns false when there are no more
+// rows, an error has occurred or the rows are closed. The rows are closed
+// automatically when Next returns false.
+func (r *Rows) Next() bool {
+	if r.closed {
+		return false
+	}
+	row, done, err := r.s.Next()
+	if done || err != nil {
+		r.err = err
+		r.Close()
+		return false
+	}
+	r.row = row
+	return true
+}
+
+// Row returns the current row.
+func (r *Rows) Row() Row {
+	return r.row
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Close stops the iteration and releases the resources held by the query's
+// sources, such as open files. Rows that are not read to the end should be
+// closed.
+func (r *Rows) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.row = nil
+	return r.s.Close()
+}
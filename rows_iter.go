@@ -0,0 +1,22 @@
+//go:build go1.23
+
+package sql
+
+import "iter"
+
+// All returns an iterator over the remaining rows. An error stops the
+// iteration and is yielded with an empty row. Breaking out of the loop
+// closes the rows.
+func (r *Rows) All() iter.Seq2[Row, error] {
+	return func(yield func(Row, error) bool) {
+		defer r.Close()
+		for r.Next() {
+			if !yield(r.row, nil) {
+				return
+			}
+		}
+		if r.err != nil {
+			yield(nil, r.err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+//go:build go1.23
+
+package sql
+
+import "testing"
+
+func TestRowsAll(t *testing.T) {
+	table := &countingTable{}
+	rows, err := New(map[string]Table{"t": table}).Query(`select n from t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := 0
+	for row, err := range rows.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum += row[0].Data.Data.(int)
+		if sum > 5 {
+			break
+		}
+	}
+	if sum != 6 {
+		t.Errorf("expected 6, got %d", sum)
+	}
+	if table.open != 0 {
+		t.Errorf("expected the iterator to be closed, got %d open", table.open)
+	}
+}
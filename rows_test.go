@@ -0,0 +1,107 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// countingTable yields ever increasing numbers and counts open iterators.
+type countingTable struct {
+	open int
+}
+
+func (t *countingTable) Columns() ([]Column, error) {
+	return []Column{{"n", Int, false}}, nil
+}
+
+func (t *countingTable) GetRows() func() (map[string]Value, error) {
+	next, _ := t.GetClosableRows()
+	return next
+}
+
+func (t *countingTable) GetClosableRows() (func() (map[string]Value, error), func() error) {
+	t.open++
+	n := 0
+	next := func() (map[string]Value, error) {
+		n++
+		return map[string]Value{"n": {Int, n}}, nil
+	}
+	return next, func() error {
+		t.open--
+		return nil
+	}
+}
+
+func TestRowsClose(t *testing.T) {
+	queries := []string{
+		`select n from t`,
+		`select n from t where n > 2`,
+		`select * from (select * from t)`,
+	}
+	for _, q := range queries {
+		t.Run(q, func(t *testing.T) {
+			table := &countingTable{}
+			rows, err := New(map[string]Table{"t": table}).Query(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 3 && rows.Next(); i++ {
+			}
+			if table.open != 1 {
+				t.Fatalf("expected 1 open iterator, got %d", table.open)
+			}
+			if err := rows.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if table.open != 0 {
+				t.Errorf("expected the iterator to be closed, got %d open", table.open)
+			}
+			if rows.Next() {
+				t.Error("Next returned true after Close")
+			}
+		})
+	}
+}
+
+func TestRowsLimitCloses(t *testing.T) {
+	table := &countingTable{}
+	rows, err := New(map[string]Table{"t": table}).Query(`select n from t limit 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Row
+	for rows.Next() {
+		got = append(got, rows.Row())
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]map[string]any{{`"n"`: 1}, {`"n"`: 2}}, rowsAsJSON(got)); diff != "" {
+		t.Error(diff)
+	}
+	if table.open != 0 {
+		t.Errorf("expected the iterator to be closed, got %d open", table.open)
+	}
+}
+
+func TestExecCloses(t *testing.T) {
+	table := &countingTable{}
+	e := New(map[string]Table{"t": table})
+	if _, err := e.ExecString(`select n from t where cast(n as bool)`); err == nil {
+		t.Fatal("expected an error")
+	}
+	if table.open != 0 {
+		t.Errorf("ExecString: expected the iterator to be closed, got %d open", table.open)
+	}
+	s, err := e.Prepare(`select n from t where cast(n as bool) = ?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Exec(true); err == nil {
+		t.Fatal("expected an error")
+	}
+	if table.open != 0 {
+		t.Errorf("Stmt.Exec: expected the iterator to be closed, got %d open", table.open)
+	}
+}
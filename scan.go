@@ -0,0 +1,274 @@
+package sql
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Scan copies the current row's values into dest, see Row.Scan.
+func (r *Rows) Scan(dest ...any) error {
+	if r.row == nil {
+		return fmt.Errorf("Scan called without a successful Next")
+	}
+	return r.row.Scan(dest...)
+}
+
+// ScanStruct copies the current row's values into a struct, see
+// Row.ScanStruct.
+func (r *Rows) ScanStruct(dest any) error {
+	if r.row == nil {
+		return fmt.Errorf("ScanStruct called without a successful Next")
+	}
+	return r.row.ScanStruct(dest)
+}
+
+// ScanAll reads the remaining rows into dest, which must be a pointer to a
+// slice. Rows are scanned into struct elements with ScanStruct, into
+// map[string]any elements by column name and into other elements with Scan,
+// in which case the rows must have a single column.
+func (r *Rows) ScanAll(dest any) error {
+	p := reflect.ValueOf(dest)
+	if p.Kind() != reflect.Pointer || p.IsNil() || p.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("expected a pointer to a slice, got %T", dest)
+	}
+	slice := p.Elem()
+	for r.Next() {
+		item := reflect.New(slice.Type().Elem())
+		if err := r.row.scanInto(item); err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, item.Elem()))
+	}
+	return r.err
+}
+
+// Scan copies the row's values into the values pointed at by dest, one
+// destination per column. Values are converted to the destination types:
+// String to string, []byte and time.Time, Int to integers and floats, Double
+// to floats, Bool to bool, Array to slices and JSON to anything that
+// encoding/json can decode into. Destinations of type *any receive plain Go
+// values and destinations of type *Value receive the values as they are.
+// NULL can be scanned only into pointers, slices, maps and interfaces.
+func (r Row) Scan(dest ...any) error {
+	if len(dest) != len(r) {
+		return fmt.Errorf("expected %d destinations, got %d", len(r), len(dest))
+	}
+	for i, d := range dest {
+		p := reflect.ValueOf(d)
+		if p.Kind() != reflect.Pointer || p.IsNil() {
+			return fmt.Errorf("destination %d: expected a non-nil pointer, got %T", i+1, d)
+		}
+		if err := scanValue(r[i].Data, p.Elem()); err != nil {
+			return fmt.Errorf("column %s: %w", cellLabel(r[i]), err)
+		}
+	}
+	return nil
+}
+
+// ScanStruct copies the row's values into the fields of the struct pointed
+// at by dest. Fields are matched to columns by name, ignoring case, the same
+// way SliceTable derives columns from fields. Columns without a matching
+// field are ignored.
+func (r Row) ScanStruct(dest any) error {
+	p := reflect.ValueOf(dest)
+	if p.Kind() != reflect.Pointer || p.IsNil() {
+		return fmt.Errorf("expected a non-nil pointer to a struct, got %T", dest)
+	}
+	return r.scanStruct(p.Elem())
+}
+
+func (r Row) scanStruct(v reflect.Value) error {
+	fields, err := structFields(v.Type())
+	if err != nil {
+		return err
+	}
+	for _, c := range r {
+		name := cellLabel(c)
+		for _, f := range fields {
+			if !strings.EqualFold(f.column.Name, name) {
+				continue
+			}
+			if err := scanValue(c.Data, v.FieldByIndex(f.index)); err != nil {
+				return fmt.Errorf("column %s: %w", name, err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// scanInto scans the row into the value pointed at by p, choosing the way
+// by the value's type.
+func (r Row) scanInto(p reflect.Value) error {
+	v := p.Elem()
+	t := v.Type()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Struct && t != timeType:
+		if v.Kind() == reflect.Pointer {
+			v.Set(reflect.New(t))
+			v = v.Elem()
+		}
+		return r.scanStruct(v)
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String:
+		m := reflect.MakeMap(t)
+		for _, c := range r {
+			item := reflect.New(t.Elem()).Elem()
+			if err := scanValue(c.Data, item); err != nil {
+				return fmt.Errorf("column %s: %w", cellLabel(c), err)
+			}
+			m.SetMapIndex(reflect.ValueOf(cellLabel(c)).Convert(t.Key()), item)
+		}
+		v.Set(m)
+		return nil
+	default:
+		return r.Scan(p.Interface())
+	}
+}
+
+// cellLabel returns the cell's name without identifier quotes and table
+// qualifiers, so that the cell of `select "t"."name"` is labeled "name".
+func cellLabel(c Cell) string {
+	if !strings.HasSuffix(c.Name, `"`) {
+		return c.Name
+	}
+	name := strings.TrimSuffix(c.Name, `"`)
+	return name[strings.LastIndex(name, `"`)+1:]
+}
+
+var valueType = reflect.TypeOf(Value{})
+
+// scanValue stores the value into dest, converting it to dest's type.
+func scanValue(v Value, dest reflect.Value) error {
+	if dest.Type() == valueType {
+		dest.Set(reflect.ValueOf(v))
+		return nil
+	}
+	if dest.Kind() == reflect.Interface && dest.NumMethod() == 0 {
+		if v.Data == nil {
+			dest.Set(reflect.Zero(dest.Type()))
+		} else {
+			dest.Set(reflect.ValueOf(goValue(v)))
+		}
+		return nil
+	}
+	if v.Data == nil {
+		switch dest.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+			dest.Set(reflect.Zero(dest.Type()))
+			return nil
+		}
+		return fmt.Errorf("can't scan NULL into %s", dest.Type())
+	}
+	if dest.Kind() == reflect.Pointer {
+		p := reflect.New(dest.Type().Elem())
+		if err := scanValue(v, p.Elem()); err != nil {
+			return err
+		}
+		dest.Set(p)
+		return nil
+	}
+
+	mismatch := fmt.Errorf("can't scan %s into %s", getTypeName(v.Type), dest.Type())
+	switch v.Type {
+	case String:
+		s := v.Data.(string)
+		switch {
+		case dest.Type() == timeType:
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return fmt.Errorf("can't scan %q into time.Time: %w", s, err)
+			}
+			dest.Set(reflect.ValueOf(t))
+		case dest.Kind() == reflect.String:
+			dest.SetString(s)
+		case dest.Kind() == reflect.Slice && dest.Type().Elem().Kind() == reflect.Uint8:
+			dest.SetBytes([]byte(s))
+		default:
+			return mismatch
+		}
+	case Int:
+		n := v.Data.(int)
+		switch dest.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if dest.OverflowInt(int64(n)) {
+				return fmt.Errorf("value %d overflows %s", n, dest.Type())
+			}
+			dest.SetInt(int64(n))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if n < 0 || dest.OverflowUint(uint64(n)) {
+				return fmt.Errorf("value %d overflows %s", n, dest.Type())
+			}
+			dest.SetUint(uint64(n))
+		case reflect.Float32, reflect.Float64:
+			dest.SetFloat(float64(n))
+		default:
+			return mismatch
+		}
+	case Double:
+		switch dest.Kind() {
+		case reflect.Float32, reflect.Float64:
+			dest.SetFloat(v.Data.(float64))
+		default:
+			return mismatch
+		}
+	case Bool:
+		if dest.Kind() != reflect.Bool {
+			return mismatch
+		}
+		dest.SetBool(v.Data.(bool))
+	case Array:
+		items := v.Data.([]Value)
+		switch dest.Kind() {
+		case reflect.Slice:
+			s := reflect.MakeSlice(dest.Type(), len(items), len(items))
+			for i, item := range items {
+				if err := scanValue(item, s.Index(i)); err != nil {
+					return fmt.Errorf("item %d: %w", i+1, err)
+				}
+			}
+			dest.Set(s)
+		case reflect.Array:
+			if dest.Len() != len(items) {
+				return fmt.Errorf("can't scan %d items into %s", len(items), dest.Type())
+			}
+			for i, item := range items {
+				if err := scanValue(item, dest.Index(i)); err != nil {
+					return fmt.Errorf("item %d: %w", i+1, err)
+				}
+			}
+		default:
+			return mismatch
+		}
+	case JSON:
+		data, err := json.Marshal(v.Data)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, dest.Addr().Interface()); err != nil {
+			return fmt.Errorf("can't scan JSON into %s: %w", dest.Type(), err)
+		}
+	default:
+		return mismatch
+	}
+	return nil
+}
+
+// goValue returns the value's data as a plain Go value, with arrays
+// converted to []any.
+func goValue(v Value) any {
+	items, ok := v.Data.([]Value)
+	if !ok {
+		return v.Data
+	}
+	r := make([]any, len(items))
+	for i, item := range items {
+		r[i] = goValue(item)
+	}
+	return r
+}
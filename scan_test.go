@@ -0,0 +1,156 @@
+package sql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func scanEngine(t *testing.T) Engine {
+	score := 4.5
+	table, err := SliceTable([]person{
+		{Name: "ann", Age: 30, Score: &score, Tags: []string{"a", "b"}, Address: address{"Oslo"}},
+		{Name: "bob", Age: 25},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(map[string]Table{"people": table})
+}
+
+func TestRowsScan(t *testing.T) {
+	rows, err := scanEngine(t).Query(`select name, age, Score, tags, address from people`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		Name    string
+		Age     int64
+		Score   *float64
+		Tags    []string
+		Address address
+	}
+	var got []result
+	for rows.Next() {
+		var r result
+		if err := rows.Scan(&r.Name, &r.Age, &r.Score, &r.Tags, &r.Address); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	score := 4.5
+	want := []result{
+		{"ann", 30, &score, []string{"a", "b"}, address{"Oslo"}},
+		{"bob", 25, nil, nil, address{""}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestRowsScanAll(t *testing.T) {
+	e := scanEngine(t)
+
+	rows, err := e.Query(`select name, age as years from people`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		Name  string `sql:"name"`
+		Years uint8  `sql:"years"`
+	}
+	var structs []result
+	if err := rows.ScanAll(&structs); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]result{{"ann", 30}, {"bob", 25}}, structs); diff != "" {
+		t.Error(diff)
+	}
+
+	rows, err = e.Query(`select name from people`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	if err := rows.ScanAll(&names); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"ann", "bob"}, names); diff != "" {
+		t.Error(diff)
+	}
+
+	rows, err = e.Query(`select name, tags from people`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var maps []map[string]any
+	if err := rows.ScanAll(&maps); err != nil {
+		t.Fatal(err)
+	}
+	wantMaps := []map[string]any{
+		{"name": "ann", "tags": []any{"a", "b"}},
+		{"name": "bob", "tags": nil},
+	}
+	if diff := cmp.Diff(wantMaps, maps); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestRowsScanErrors(t *testing.T) {
+	cases := []struct {
+		query string
+		dest  func() []any
+		err   string
+	}{
+		{
+			`select name from people`,
+			func() []any { var x int; return []any{&x} },
+			"column name: can't scan String into int",
+		},
+		{
+			`select Score from people where name = 'bob'`,
+			func() []any { var x float64; return []any{&x} },
+			"column Score: can't scan NULL into float64",
+		},
+		{
+			`select age from people`,
+			func() []any { var x int8; return []any{&x} },
+			"",
+		},
+		{
+			`select 300 as n from people`,
+			func() []any { var x uint8; return []any{&x} },
+			"column n: value 300 overflows uint8",
+		},
+		{
+			`select name, age from people`,
+			func() []any { var x string; return []any{&x} },
+			"expected 2 destinations, got 1",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			rows, err := scanEngine(t).Query(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !rows.Next() {
+				t.Fatal("no rows", rows.Err())
+			}
+			err = rows.Scan(c.dest()...)
+			if c.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("expected error %q, got %v", c.err, err)
+			}
+		})
+	}
+}
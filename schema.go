@@ -0,0 +1,122 @@
+package sql
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Column describes a table column.
+type Column struct {
+	Name     string      `json:"name"`
+	Type     ValueTypeID `json:"type"`
+	Nullable bool        `json:"nullable"`
+}
+
+// Schema is an explicit declaration of a table's columns. Rows read from a
+// source with a schema are converted to it.
+type Schema struct {
+	Columns []Column `json:"columns"`
+
+	// Strict makes rows with values that can't be converted to the column
+	// types, nulls in non-nullable columns or unknown columns fail.
+	// Otherwise such values become nulls and unknown columns are dropped.
+	Strict bool `json:"strict"`
+}
+
+// ReadSchema reads a schema in JSON format, for example:
+//
+//	{"columns": [{"name": "zip", "type": "String", "nullable": true}], "strict": true}
+func ReadSchema(r io.Reader) (*Schema, error) {
+	var s Schema
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Schema) column(name string) (Column, bool) {
+	for _, c := range s.Columns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Column{}, false
+}
+
+func (s *Schema) names() []string {
+	var r []string
+	for _, c := range s.Columns {
+		r = append(r, c.Name)
+	}
+	return r
+}
+
+// coerce converts the values to the schema.
+func (s *Schema) coerce(values map[string]Value) (map[string]Value, error) {
+	if s.Strict {
+		for k := range values {
+			if _, ok := s.column(k); !ok {
+				return nil, fmt.Errorf("unexpected column %s", k)
+			}
+		}
+	}
+	row := map[string]Value{}
+	for _, c := range s.Columns {
+		v := values[c.Name]
+		if v.Data == nil {
+			if s.Strict && !c.Nullable {
+				return nil, fmt.Errorf("column %s: null in a non-nullable column", c.Name)
+			}
+			row[c.Name] = Value{c.Type, nil}
+			continue
+		}
+		cv, err := v.cast(c.Type)
+		if err != nil {
+			if s.Strict {
+				return nil, fmt.Errorf("column %s: %w", c.Name, err)
+			}
+			cv = Value{c.Type, nil}
+		}
+		row[c.Name] = cv
+	}
+	return row, nil
+}
+
+// describeTable returns the table's schema as rows.
+func describeTable(t Table) ([]Row, error) {
+	// The columns of a files table are known once all its files are read.
+	if ft, ok := t.(*filesTable); ok {
+		if err := ft.mergeColumns(ft.paths); err != nil {
+			return nil, err
+		}
+	}
+	columns, err := t.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var rows []Row
+	for _, c := range columns {
+		rows = append(rows, Row{
+			{"", "name", Value{String, c.Name}},
+			{"", "type", Value{String, getTypeName(c.Type)}},
+			{"", "nullable", Value{Bool, c.Nullable}},
+		})
+	}
+	return rows, nil
+}
+
+// MarshalText returns the type's name.
+func (t ValueTypeID) MarshalText() ([]byte, error) {
+	return []byte(getTypeName(t)), nil
+}
+
+// UnmarshalText parses a type name.
+func (t *ValueTypeID) UnmarshalText(text []byte) error {
+	id := getTypeID(string(text))
+	if id == undefined {
+		return fmt.Errorf("unknown type: %s", text)
+	}
+	*t = id
+	return nil
+}
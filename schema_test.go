@@ -0,0 +1,81 @@
+package sql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSchema(t *testing.T) {
+	schema, err := ReadSchema(strings.NewReader(`{"columns": [
+		{"name": "zip", "type": "String"},
+		{"name": "n", "type": "Int", "nullable": true}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	strict := *schema
+	strict.Strict = true
+
+	cases := []struct {
+		name  string
+		table Table
+		query string
+		want  []map[string]any
+	}{
+		{
+			"csv keeps zip codes as strings",
+			CsvStream(strings.NewReader("zip,n\n02134,1\n10001,x\n"), CsvOptions{Schema: schema}),
+			`select zip, n from t`,
+			[]map[string]any{{`"zip"`: "02134", `"n"`: 1}, {`"zip"`: "10001", `"n"`: nil}},
+		},
+		{
+			"json numbers converted to strings",
+			JsonStream(strings.NewReader(`{"zip": 2134, "n": "2", "other": 1}`), JsonOptions{Schema: schema}),
+			`select * from t`,
+			[]map[string]any{{"zip": "2134", "n": 2}},
+		},
+		{
+			"describe",
+			JsonStream(strings.NewReader(``), JsonOptions{Schema: schema}),
+			`describe t`,
+			[]map[string]any{
+				{"name": "zip", "type": "String", "nullable": false},
+				{"name": "n", "type": "Int", "nullable": true},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := New(map[string]Table{"t": c.table}).ExecString(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(rowsAsJSON(r), c.want); diff != "" {
+				t.Fatalf("%s", diff)
+			}
+		})
+	}
+
+	errors := []struct {
+		data string
+		err  string
+	}{
+		{`{"zip": "1", "n": "x"}`, `line 1: column n: strconv.Atoi: parsing "x": invalid syntax`},
+		{`{"n": 1}`, "line 1: column zip: null in a non-nullable column"},
+		{`{"zip": "1", "other": 1}`, "line 1: unexpected column other"},
+	}
+	for _, c := range errors {
+		t.Run(c.data, func(t *testing.T) {
+			table := JsonStream(strings.NewReader(c.data), JsonOptions{Schema: &strict})
+			_, err := New(map[string]Table{"t": table}).ExecString(`select * from t`)
+			if err == nil {
+				t.Fatalf("expected an error, got nil")
+			}
+			if diff := cmp.Diff(c.err, err.Error()); diff != "" {
+				t.Fatalf("%s", diff)
+			}
+		})
+	}
+}
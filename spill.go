@@ -0,0 +1,515 @@
+package sql
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// rowEncoder writes rows and values in a compact binary form.
+//
+// A value is its type byte, a null byte and, if not null, the data: Int is a
+// varint, Double is 8 bytes of the IEEE 754 representation, Bool is a byte,
+// String is a length-prefixed string, Array is a count followed by the
+// items, and JSON is its length-prefixed text. A row is a cell count
+// followed by the cells' table names, names and values.
+type rowEncoder struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (e *rowEncoder) uvarint(x uint64) error {
+	n := binary.PutUvarint(e.buf[:], x)
+	_, err := e.w.Write(e.buf[:n])
+	return err
+}
+
+func (e *rowEncoder) varint(x int64) error {
+	n := binary.PutVarint(e.buf[:], x)
+	_, err := e.w.Write(e.buf[:n])
+	return err
+}
+
+func (e *rowEncoder) string(s string) error {
+	if err := e.uvarint(uint64(len(s))); err != nil {
+		return err
+	}
+	_, err := e.w.WriteString(s)
+	return err
+}
+
+func (e *rowEncoder) value(v Value) error {
+	if err := e.w.WriteByte(byte(v.Type)); err != nil {
+		return err
+	}
+	if v.Data == nil {
+		return e.w.WriteByte(1)
+	}
+	if err := e.w.WriteByte(0); err != nil {
+		return err
+	}
+	// JSON data may be a string, a number or a bool as well, which are
+	// written as text all the same.
+	if v.Type == JSON {
+		text, err := json.Marshal(v.Data)
+		if err != nil {
+			return err
+		}
+		return e.string(string(text))
+	}
+	switch d := v.Data.(type) {
+	case int:
+		return e.varint(int64(d))
+	case float64:
+		binary.LittleEndian.PutUint64(e.buf[:8], math.Float64bits(d))
+		_, err := e.w.Write(e.buf[:8])
+		return err
+	case bool:
+		if d {
+			return e.w.WriteByte(1)
+		}
+		return e.w.WriteByte(0)
+	case string:
+		return e.string(d)
+	case []Value:
+		if err := e.uvarint(uint64(len(d))); err != nil {
+			return err
+		}
+		for _, item := range d {
+			if err := e.value(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("can't encode %s value %v", getTypeName(v.Type), v.Data)
+}
+
+func (e *rowEncoder) row(r Row) error {
+	if err := e.uvarint(uint64(len(r))); err != nil {
+		return err
+	}
+	for _, c := range r {
+		if err := e.string(c.TableName); err != nil {
+			return err
+		}
+		if err := e.string(c.Name); err != nil {
+			return err
+		}
+		if err := e.value(c.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rowDecoder reads what rowEncoder writes.
+type rowDecoder struct {
+	r *bufio.Reader
+}
+
+func (d *rowDecoder) uvarint() (uint64, error) {
+	return binary.ReadUvarint(d.r)
+}
+
+func (d *rowDecoder) string() (string, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (d *rowDecoder) value() (Value, error) {
+	t, err := d.r.ReadByte()
+	if err != nil {
+		return Value{}, err
+	}
+	v := Value{Type: ValueTypeID(t)}
+	null, err := d.r.ReadByte()
+	if err != nil || null == 1 {
+		return v, err
+	}
+	switch v.Type {
+	case Int:
+		x, err := binary.ReadVarint(d.r)
+		v.Data = int(x)
+		return v, err
+	case Double:
+		var b [8]byte
+		_, err := io.ReadFull(d.r, b[:])
+		v.Data = math.Float64frombits(binary.LittleEndian.Uint64(b[:]))
+		return v, err
+	case Bool:
+		b, err := d.r.ReadByte()
+		v.Data = b == 1
+		return v, err
+	case String:
+		v.Data, err = d.string()
+		return v, err
+	case Array:
+		n, err := d.uvarint()
+		if err != nil {
+			return v, err
+		}
+		items := make([]Value, n)
+		for i := range items {
+			if items[i], err = d.value(); err != nil {
+				return v, err
+			}
+		}
+		v.Data = items
+		return v, nil
+	case JSON:
+		text, err := d.string()
+		if err != nil {
+			return v, err
+		}
+		var x any
+		dec := json.NewDecoder(strings.NewReader(text))
+		dec.UseNumber()
+		if err := dec.Decode(&x); err != nil {
+			return v, err
+		}
+		v.Data = plainJSON(x)
+		return v, nil
+	}
+	return v, fmt.Errorf("can't decode a value of type %d", t)
+}
+
+func (d *rowDecoder) row() (Row, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	r := make(Row, n)
+	for i := range r {
+		if r[i].TableName, err = d.string(); err != nil {
+			return nil, err
+		}
+		if r[i].Name, err = d.string(); err != nil {
+			return nil, err
+		}
+		if r[i].Data, err = d.value(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// spillFile is a temporary file of groups that is written once and then
+// read once. The values of the groups' aggregates are stored in the order of
+// aggs.
+type spillFile struct {
+	name string
+	enc  rowEncoder
+	aggs []*aggregate
+
+	// f is the open file, nil between close and read.
+	f *os.File
+}
+
+func newSpillFile(aggs []*aggregate) (*spillFile, error) {
+	f, err := os.CreateTemp("", "sql-spill-")
+	if err != nil {
+		return nil, err
+	}
+	return &spillFile{f.Name(), rowEncoder{w: bufio.NewWriter(f)}, aggs, f}, nil
+}
+
+// close finishes writing and closes the file, so that it doesn't take a
+// file descriptor until it is read.
+func (s *spillFile) close() error {
+	err := s.enc.w.Flush()
+	if err2 := s.f.Close(); err == nil {
+		err = err2
+	}
+	s.f = nil
+	if err != nil {
+		os.Remove(s.name)
+	}
+	return err
+}
+
+func (s *spillFile) write(kg keyedGroup) error {
+	if err := s.enc.uvarint(uint64(kg.seq)); err != nil {
+		return err
+	}
+	if err := s.enc.uvarint(uint64(len(kg.keys))); err != nil {
+		return err
+	}
+	for _, k := range kg.keys {
+		if err := s.enc.value(k); err != nil {
+			return err
+		}
+	}
+	if err := s.enc.row(kg.g.row); err != nil {
+		return err
+	}
+	for _, a := range s.aggs {
+		if err := s.enc.value(kg.g.aggs[a]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read returns the stream of the written groups. Closing the stream
+// removes the file.
+func (s *spillFile) read() (*Stream[keyedGroup], error) {
+	if s.f == nil {
+		f, err := os.Open(s.name)
+		if err != nil {
+			s.remove()
+			return nil, err
+		}
+		s.f = f
+	} else {
+		if err := s.enc.w.Flush(); err != nil {
+			s.remove()
+			return nil, err
+		}
+		if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+			s.remove()
+			return nil, err
+		}
+	}
+	d := rowDecoder{bufio.NewReader(s.f)}
+	return &Stream[keyedGroup]{
+		"spill " + s.name,
+		func() (keyedGroup, bool, error) {
+			seq, err := d.uvarint()
+			if err == io.EOF {
+				return keyedGroup{}, true, nil
+			}
+			if err != nil {
+				return keyedGroup{}, false, err
+			}
+			kg := keyedGroup{seq: int(seq)}
+			n, err := d.uvarint()
+			if err != nil {
+				return kg, false, err
+			}
+			kg.keys = make([]Value, n)
+			for i := range kg.keys {
+				if kg.keys[i], err = d.value(); err != nil {
+					return kg, false, err
+				}
+			}
+			if kg.g.row, err = d.row(); err != nil {
+				return kg, false, err
+			}
+			if len(s.aggs) > 0 {
+				kg.g.aggs = map[*aggregate]Value{}
+			}
+			for _, a := range s.aggs {
+				if kg.g.aggs[a], err = d.value(); err != nil {
+					return kg, false, err
+				}
+			}
+			return kg, false, nil
+		},
+		s.remove,
+	}, nil
+}
+
+// remove closes and deletes the file.
+func (s *spillFile) remove() error {
+	var err error
+	if s.f != nil {
+		err = s.f.Close()
+		s.f = nil
+	}
+	if err2 := os.Remove(s.name); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// writeRun writes the groups to a new spill file and closes it.
+func writeRun(groups *Stream[keyedGroup], aggs []*aggregate) (*spillFile, error) {
+	f, err := newSpillFile(aggs)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		kg, done, err := groups.Next()
+		if err == nil && !done {
+			err = f.write(kg)
+		}
+		if err != nil {
+			f.remove()
+			return nil, err
+		}
+		if done {
+			break
+		}
+	}
+	if err := f.close(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// maxMergeRuns limits the number of sorted runs that are merged at once,
+// and so the number of spill files open at a time.
+const maxMergeRuns = 64
+
+// mergeRuns returns the stream of the groups of the sorted runs in the
+// order of the order specs. Closing the stream removes the runs' files.
+func mergeRuns(runs []*spillFile, orderBy []orderspec) (*Stream[keyedGroup], error) {
+	var sources []*Stream[keyedGroup]
+	for i, r := range runs {
+		s, err := r.read()
+		if err != nil {
+			for _, s := range sources {
+				s.Close()
+			}
+			for _, r := range runs[i+1:] {
+				r.remove()
+			}
+			return nil, err
+		}
+		sources = append(sources, s)
+	}
+	return mergeSorted(sources, orderBy), nil
+}
+
+// groupAggregates returns the aggregates computed for the group.
+func groupAggregates(g group) []*aggregate {
+	var aggs []*aggregate
+	for a := range g.aggs {
+		aggs = append(aggs, a)
+	}
+	return aggs
+}
+
+// mergeSorted merges the streams of groups, each sorted by the order specs
+// and the input positions, into one sorted stream.
+func mergeSorted(sources []*Stream[keyedGroup], orderBy []orderspec) *Stream[keyedGroup] {
+	h := &mergeHeap{orderBy: orderBy}
+	pull := func(i int) error {
+		kg, done, err := sources[i].Next()
+		if err != nil || done {
+			return err
+		}
+		heap.Push(h, mergeItem{kg, i})
+		return h.err
+	}
+	init := false
+	return &Stream[keyedGroup]{
+		"merge",
+		func() (keyedGroup, bool, error) {
+			if !init {
+				init = true
+				for i := range sources {
+					if err := pull(i); err != nil {
+						return keyedGroup{}, false, err
+					}
+				}
+			}
+			if len(h.items) == 0 {
+				return keyedGroup{}, true, nil
+			}
+			item := heap.Pop(h).(mergeItem)
+			if err := pull(item.source); err != nil {
+				return keyedGroup{}, false, err
+			}
+			return item.kg, false, h.err
+		},
+		func() error {
+			var err error
+			for _, s := range sources {
+				if err2 := s.Close(); err == nil {
+					err = err2
+				}
+			}
+			return err
+		},
+	}
+}
+
+// mergeItem is the next group of a merged stream.
+type mergeItem struct {
+	kg     keyedGroup
+	source int
+}
+
+// mergeHeap is a heap of the next groups of the merged streams with the
+// first group on top.
+type mergeHeap struct {
+	items   []mergeItem
+	orderBy []orderspec
+
+	// err is the first error in comparing keys.
+	err error
+}
+
+func (h *mergeHeap) Len() int      { return len(h.items) }
+func (h *mergeHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *mergeHeap) Push(x any)    { h.items = append(h.items, x.(mergeItem)) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	r, err := before(h.items[i].kg, h.items[j].kg, h.orderBy)
+	if err != nil && h.err == nil {
+		h.err = err
+	}
+	return r
+}
+
+func (h *mergeHeap) Pop() any {
+	x := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return x
+}
+
+// partitionOf returns the spill partition for the group key. The depth of
+// the partitioning changes the hash so that a partition that is still too
+// big splits further.
+func partitionOf(key string, depth, partitions int) int {
+	h := fnv.New32a()
+	h.Write([]byte{byte(depth)})
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(partitions))
+}
+
+// rowSize estimates the memory taken by the row.
+func rowSize(r Row) int64 {
+	n := int64(24)
+	for _, c := range r {
+		n += 64 + int64(len(c.TableName)+len(c.Name)) + valueSize(c.Data)
+	}
+	return n
+}
+
+// groupSize estimates the memory taken by the group with its sort keys.
+func groupSize(kg keyedGroup) int64 {
+	return rowSize(kg.g.row) + 64*int64(len(kg.g.aggs)+len(kg.keys))
+}
+
+func valueSize(v Value) int64 {
+	switch d := v.Data.(type) {
+	case string:
+		return int64(len(d))
+	case []Value:
+		n := int64(24)
+		for _, item := range d {
+			n += 32 + valueSize(item)
+		}
+		return n
+	case map[string]any, []any:
+		return 256
+	}
+	return 0
+}
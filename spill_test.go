@@ -0,0 +1,124 @@
+package sql
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRowEncoding(t *testing.T) {
+	row := Row{
+		{"t", "s", Value{String, "hello"}},
+		{"t", "i", Value{Int, -42}},
+		{"t", "d", Value{Double, 1.5}},
+		{"t", "b", Value{Bool, true}},
+		{"t", "a", Value{Array, []Value{{Int, 1}, {String, "x"}, {Int, nil}}}},
+		{"t", "j", Value{JSON, map[string]any{"k": []any{1, "v"}}}},
+		{"t", "js", Value{JSON, "str"}},
+		{"t", "jn", Value{JSON, 1.5}},
+		{"t", "jb", Value{JSON, true}},
+		{"", "null", Value{Int, nil}},
+	}
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := (&rowEncoder{w: w}).row(row); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	got, err := (&rowDecoder{bufio.NewReader(&buf)}).row()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(row, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func spillEngine() Engine {
+	var data strings.Builder
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&data, `{"n": %d, "k": %d, "s": "s%d", "tags": [%d]}`+"\n", i, i%37, i%5, i%3)
+	}
+	return New(map[string]Table{"t": JsonStream(strings.NewReader(data.String()), JsonOptions{})})
+}
+
+func TestSpill(t *testing.T) {
+	queries := []string{
+		`select n, k from t order by k desc, s`,
+		`select n from t order by s limit 300`,
+		`select k, count(*), min(n) from t group by k`,
+		`select s, k, count(*) from t group by s, k order by count(*) desc, s`,
+		`select distinct s from t`,
+		`select distinct k, s from t order by k`,
+		`select distinct * from (select k, tags from t)`,
+	}
+	for _, q := range queries {
+		t.Run(q, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("TMPDIR", dir)
+			want, err := spillEngine().ExecString(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := spillEngine().WithMemoryLimit(1000).ExecString(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Error(diff)
+			}
+			if files, _ := os.ReadDir(dir); len(files) != 0 {
+				t.Errorf("%d spill files left", len(files))
+			}
+		})
+	}
+}
+
+func TestSpillCleanup(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	for _, q := range []string{`select n from t order by k`, `select distinct k from t`} {
+		rows, err := spillEngine().WithMemoryLimit(1000).Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !rows.Next() {
+			t.Fatal(rows.Err())
+		}
+		files, _ := os.ReadDir(dir)
+		if len(files) == 0 {
+			t.Errorf("%s: expected spill files", q)
+		}
+		rows.Close()
+		files, _ = os.ReadDir(dir)
+		if len(files) != 0 {
+			t.Errorf("%s: %d spill files left after Close", q, len(files))
+		}
+	}
+}
+
+func TestSpillJSON(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	data := `{"n": 5, "j": {"x": 1}}` + "\n" + `{"n": 4, "j": "str"}` + "\n" + `{"n": 3, "j": 2.5}` + "\n" + `{"n": 2, "j": true}` + "\n" + `{"n": 1, "j": "str"}` + "\n"
+	engine := func() Engine {
+		return New(map[string]Table{"t": JsonStream(strings.NewReader(data), JsonOptions{})})
+	}
+	for _, q := range []string{`select j from t order by n`, `select j, count(*) from t group by j`} {
+		want, err := engine().ExecString(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := engine().WithMemoryLimit(1).ExecString(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("%s: %s", q, diff)
+		}
+	}
+}
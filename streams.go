@@ -2,12 +2,14 @@ package sql
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
 type Stream[T any] struct {
-	name string
-	gen  func() (T, bool, error)
+	name  string
+	gen   func() (T, bool, error)
+	close func() error
 }
 
 func (s *Stream[T]) Next() (T, bool, error) {
@@ -16,6 +18,18 @@ func (s *Stream[T]) Next() (T, bool, error) {
 	return t, done, err
 }
 
+// Close releases the resources held by the stream's sources, such as open
+// files, when the stream is not going to be read to the end. It is safe to
+// call Close more than once.
+func (s *Stream[T]) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	c := s.close
+	s.close = nil
+	return c()
+}
+
 func (r Row) String() string {
 	b := strings.Builder{}
 	b.WriteString("Row {")
@@ -48,6 +62,7 @@ func (s *Stream[T]) filter(f func(T) (bool, error)) *Stream[T] {
 				}
 			}
 		},
+		s.Close,
 	}
 }
 
@@ -62,14 +77,19 @@ func (s *Stream[T]) limit(take int) *Stream[T] {
 			}
 			i++
 			return s.Next()
-		}}
+		},
+		s.Close,
+	}
 }
 
+// Consume reads the stream to the end and closes it, also when reading
+// fails, so that the stream's sources release their files.
 func (s *Stream[T]) Consume() ([]T, error) {
 	var groups []T
 	for {
 		r, done, err := s.Next()
 		if err != nil {
+			s.Close()
 			return nil, err
 		}
 		if done {
@@ -77,6 +97,9 @@ func (s *Stream[T]) Consume() ([]T, error) {
 		}
 		groups = append(groups, r)
 	}
+	if err := s.Close(); err != nil {
+		return nil, err
+	}
 	return groups, nil
 }
 
@@ -92,46 +115,85 @@ func mapStream[T, U any](s *Stream[T], f func(T) (U, error)) *Stream[U] {
 			val, err := f(rows)
 			return val, false, err
 		},
+		s.Close,
 	}
 }
 
-func rewindable(xs *Stream[Row]) (*Stream[Row], func() *Stream[Row]) {
-	var items []Row
-	rewind := func() *Stream[Row] {
+func rewindable[T any](xs *Stream[T]) (*Stream[T], func() *Stream[T]) {
+	var items []T
+	rewind := func() *Stream[T] {
 		return arrstream(items)
 	}
-	s := &Stream[Row]{
+	s := &Stream[T]{
 		xs.name + ".rewindable",
-		func() (Row, bool, error) {
+		func() (T, bool, error) {
 			x, done, err := xs.Next()
 			if err != nil || done {
-				return nil, done, err
+				return x, done, err
 			}
 			items = append(items, x)
 			return x, false, nil
 		},
+		xs.Close,
 	}
 	return s, rewind
 }
 
-func tablestream(tableName string, s func() (map[string]Value, error)) *Stream[Row] {
+// tablestream returns a stream of the table's rows with cells in the order
+// of the table's columns. close, if not nil, releases the resources of next.
+func tablestream(tableName string, t Table, next func() (map[string]Value, error), close func() error) *Stream[Row] {
+	var columns []Column
 	return &Stream[Row]{
 		"table " + tableName,
 		func() (Row, bool, error) {
-			row, err := s()
+			row, err := next()
 			if err != nil {
 				return nil, false, err
 			}
 			if row == nil {
 				return nil, true, nil
 			}
-			var result []Cell
-			for name, value := range row {
-				result = append(result, Cell{tableName, name, value})
+			// Sources may discover new columns as they read.
+			if columns == nil || len(row) > len(columns) {
+				columns, err = t.Columns()
+				if err != nil {
+					return nil, false, err
+				}
+			}
+			result := make(Row, 0, len(row))
+			for _, c := range columns {
+				value, ok := row[c.Name]
+				if !ok {
+					continue
+				}
+				result = append(result, Cell{tableName, c.Name, value})
+			}
+			if len(result) < len(row) {
+				result = append(result, undeclaredCells(tableName, row, columns)...)
 			}
 			return result, false, nil
 		},
+		close,
+	}
+}
+
+// undeclaredCells returns cells for the row's values that are not among the
+// columns, sorted by name.
+func undeclaredCells(tableName string, row map[string]Value, columns []Column) []Cell {
+	declared := map[string]bool{}
+	for _, c := range columns {
+		declared[c.Name] = true
+	}
+	var r []Cell
+	for name, value := range row {
+		if !declared[name] {
+			r = append(r, Cell{tableName, name, value})
+		}
 	}
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Name < r[j].Name
+	})
+	return r
 }
 
 func arrstream[T any](xs []T) *Stream[T] {
@@ -147,5 +209,6 @@ func arrstream[T any](xs []T) *Stream[T] {
 			i++
 			return r, false, nil
 		},
+		nil,
 	}
 }
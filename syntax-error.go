@@ -0,0 +1,78 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SyntaxError is an error in the text of a query.
+type SyntaxError struct {
+	// Line and Column locate the offending token, both start with 1.
+	Line   int
+	Column int
+
+	// Token is the offending token, empty at the end of the query.
+	Token string
+
+	// Expected lists what could appear instead of the token, if known.
+	Expected []string
+
+	// Message describes the error when Expected is empty.
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	got := "end of query"
+	if e.Token != "" {
+		got = fmt.Sprintf("%q", e.Token)
+	}
+	var msg string
+	switch {
+	case len(e.Expected) > 0 && e.Message != "":
+		msg = fmt.Sprintf("%s: expected %s, got %s", e.Message, alternatives(e.Expected), got)
+	case len(e.Expected) > 0:
+		msg = fmt.Sprintf("expected %s, got %s", alternatives(e.Expected), got)
+	case e.Message != "":
+		msg = fmt.Sprintf("%s: %s", got, e.Message)
+	default:
+		msg = "unexpected " + got
+	}
+	return fmt.Sprintf("syntax error at line %d, column %d: %s", e.Line, e.Column, msg)
+}
+
+// alternatives returns the list as "a, b or c".
+func alternatives(list []string) string {
+	if len(list) == 1 {
+		return list[0]
+	}
+	return strings.Join(list[:len(list)-1], ", ") + " or " + list[len(list)-1]
+}
+
+// errorAt returns a syntax error at the token.
+func (tr *tokenizer) errorAt(t token, expected []string, message string) *SyntaxError {
+	line, column := tr.b.Position(t.pos)
+	text := t.val
+	switch t.t {
+	case tEnd:
+		text = ""
+	case tString:
+		text = "'" + t.val + "'"
+	}
+	return &SyntaxError{line, column, text, expected, message}
+}
+
+// expected returns a syntax error telling that one of the alternatives was
+// expected instead of the next token.
+func (tr *tokenizer) expected(alternatives ...string) error {
+	t, err := tr.next()
+	if err != nil {
+		return err
+	}
+	tr.unget(t)
+	return tr.errorAt(t, alternatives, "")
+}
+
+// errorf returns a syntax error at the token with the formatted message.
+func (tr *tokenizer) errorf(t token, format string, args ...any) error {
+	return tr.errorAt(t, nil, fmt.Sprintf(format, args...))
+}
@@ -9,8 +9,12 @@ import (
 )
 
 func TestQueries(t *testing.T) {
+	cars, err := JsonTable("test-data.json", JsonOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
 	data := map[string]Table{
-		"cars": JsonTable("test-data.json"),
+		"cars": cars,
 		"t1": dummy{
 			{"id": Value{Int, 1}, "name": Value{String, "one"}},
 			{"id": Value{Int, 2}, "name": Value{String, "'"}},
@@ -28,6 +32,11 @@ func TestQueries(t *testing.T) {
 		"a-b": dummy{
 			{"x": Value{Int, 1}},
 		},
+		"t4": dummy{
+			{"a": Value{Int, nil}},
+			{"a": Value{Int, 3}},
+			{"a": Value{Int, 2}},
+		},
 	}
 
 	mp := func(rr []map[string]any) string {
@@ -119,6 +128,19 @@ func TestQueries(t *testing.T) {
 		{`"year"`: 2009, `min("price")`: 30000},
 		{`"year"`: 2005, `min("price")`: 69000},
 	})
+	check("distinct groups", `select distinct count(*) as n from t1 group by id`, []map[string]any{
+		{"n": 1},
+	})
+	check("distinct groups ordered", `select distinct bucket, count(*) as n from t2 group by bucket order by n desc`, []map[string]any{
+		{`"bucket"`: 2, "n": 2},
+		{`"bucket"`: 1, "n": 1},
+	})
+	check("distinct aggregate", `select distinct count(*) from t2`, []map[string]any{
+		{"count(*)": 3},
+	})
+	check("min skips nulls", `select min(a), count(a) from t4`, []map[string]any{
+		{`min("a")`: 2, `count("a")`: 2},
+	})
 
 	check("...", `select bucket, x from t2 join t3 on array_contains(array[1,2,3], 1)`, []map[string]any{
 		{"\"bucket\"": 1, `"x"`: 1},
@@ -151,6 +173,9 @@ func TestQueries(t *testing.T) {
 		{`"name"`: "BMW Z4 Roadster (II)", `"weight"`: nil},
 		{`"name"`: "Kia Soul", `"weight"`: nil},
 	})
+	check("count non-null values", `select count(weight) from cars`, []map[string]any{
+		{`count("weight")`: 1},
+	})
 	check("filter", `select year from cars where year < 2009`, []map[string]any{
 		{`"year"`: 2005},
 	})
@@ -3,23 +3,28 @@ package sql
 import (
 	"fmt"
 	"strings"
+	"unicode/utf8"
 )
 
 type tokenType string
 
 const (
-	tEnd        tokenType = "end"
-	tString               = "string"
-	tIdentifier           = "identifier"
-	tNumber               = "number"
-	tKeyword              = "keyword"
-	tOp                   = "operator"
-	tError                = "error"
+	tEnd         tokenType = "end"
+	tString                = "string"
+	tIdentifier            = "identifier"
+	tNumber                = "number"
+	tKeyword               = "keyword"
+	tOp                    = "operator"
+	tPlaceholder           = "placeholder"
+	tError                 = "error"
 )
 
 type token struct {
 	t   tokenType
 	val string
+
+	// pos is the offset of the token in the query.
+	pos int
 }
 
 func (t token) String() string {
@@ -29,6 +34,15 @@ func (t token) String() string {
 type tokenizer struct {
 	b     *Parsebuf
 	peeks []token
+
+	// positional counts the ? placeholders read so far.
+	positional int
+
+	// isAggregate tells whether a function name is an aggregate.
+	isAggregate func(string) bool
+
+	// err is the error that stopped the tokenizer.
+	err error
 }
 
 func (tr *tokenizer) unget(t token) {
@@ -38,7 +52,7 @@ func (tr *tokenizer) unget(t token) {
 func (tr *tokenizer) peek() token {
 	s, err := tr.next()
 	if err != nil {
-		return token{tError, err.Error()}
+		return token{tError, err.Error(), tr.b.Pos()}
 	}
 	if s.t != tEnd {
 		tr.unget(s)
@@ -50,11 +64,12 @@ var operators = []string{
 	"=", "*", ".", "[", "]", "(", ")", ",", "<", ">",
 }
 var keywords = []string{
-	"select", "as", "from", "join", "on", "where", "order", "group", "by", "limit",
+	"select", "distinct", "as", "from", "join", "on", "where", "order", "group", "by", "limit",
 	"desc", "asc",
 	"or", "and",
 	"array", "true", "false",
 	"int",
+	"describe", "explain", "analyze",
 }
 
 func (tr *tokenizer) next() (token, error) {
@@ -63,52 +78,87 @@ func (tr *tokenizer) next() (token, error) {
 		tr.peeks = tr.peeks[0 : len(tr.peeks)-1]
 		return r, nil
 	}
+	if tr.err != nil {
+		return token{}, tr.err
+	}
 	tr.b.Space()
+	pos := tr.b.Pos()
+	t, err := tr.read()
+	t.pos = pos
+	if err != nil {
+		tr.err = tr.errorAt(token{tError, tr.b.str[pos:tr.b.Pos()], pos}, nil, err.Error())
+		return t, tr.err
+	}
+	return t, nil
+}
+
+// read reads the next token after the spaces.
+func (tr *tokenizer) read() (token, error) {
 	if tr.b.Peek() == "" {
-		return token{tEnd, ""}, nil
+		return token{t: tEnd}, nil
 	}
 	if tr.b.Peek() == "'" {
 		s, err := readQuote(tr.b, "'")
 		if err != nil {
-			panic(err)
+			return token{}, err
 		}
-		return token{tString, s}, nil
+		return token{t: tString, val: s}, nil
 	}
 	if tr.b.Peek() == "\"" {
 		s, err := readQuote(tr.b, "\"")
 		if err != nil {
-			panic(err)
+			return token{}, err
 		}
-		return token{tIdentifier, s}, nil
+		return token{t: tIdentifier, val: s}, nil
 	}
-	if tr.b.Peek() == "-" {
+	if rest := tr.b.Rest(); rest[0] == '-' && len(rest) > 1 && rest[1] >= '0' && rest[1] <= '9' {
 		tr.b.Get()
-		if tr.b.Peek()[0] >= '0' && tr.b.Peek()[0] <= '9' {
-			s := "-" + tr.b.Set("0123456789")
-			return token{tNumber, s}, nil
-		}
+		s := "-" + tr.b.Set("0123456789")
+		return token{t: tNumber, val: s}, nil
 	}
 	if tr.b.Peek()[0] >= '0' && tr.b.Peek()[0] <= '9' {
 		s := tr.b.Set("0123456789")
-		return token{tNumber, s}, nil
+		return token{t: tNumber, val: s}, nil
+	}
+	if tr.b.Peek() == "?" {
+		tr.b.Get()
+		return token{t: tPlaceholder, val: "?"}, nil
+	}
+	if tr.b.Peek() == "$" {
+		tr.b.Get()
+		s := tr.b.Set("0123456789")
+		if s == "" {
+			return token{}, fmt.Errorf("expected parameter number after $")
+		}
+		return token{t: tPlaceholder, val: "$" + s}, nil
+	}
+	if tr.b.Peek() == ":" {
+		tr.b.Get()
+		s := tr.b.Set("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_")
+		if s == "" {
+			return token{}, fmt.Errorf("expected parameter name after :")
+		}
+		return token{t: tPlaceholder, val: ":" + s}, nil
 	}
 	for _, s := range operators {
 		if tr.b.Peek() == s {
 			tr.b.Get()
-			return token{tOp, s}, nil
+			return token{t: tOp, val: s}, nil
 		}
 	}
 
 	s := tr.b.Set("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_")
 	if s == "" {
-		return token{}, fmt.Errorf("unexpected trailing string: %s", tr.b.Rest())
+		_, size := utf8.DecodeRuneInString(tr.b.Rest())
+		tr.b.Literal(tr.b.Rest()[:size])
+		return token{}, fmt.Errorf("unexpected character")
 	}
 	for _, tok := range keywords {
 		if strings.ToLower(s) == tok {
-			return token{tKeyword, strings.ToUpper(s)}, nil
+			return token{t: tKeyword, val: strings.ToUpper(s)}, nil
 		}
 	}
-	return token{tIdentifier, s}, nil
+	return token{t: tIdentifier, val: s}, nil
 }
 
 func (tr *tokenizer) eat(t tokenType, val string) bool {
@@ -141,13 +191,18 @@ func readQuote(b *Parsebuf, q string) (string, error) {
 			continue
 		}
 		if b.Peek() == q {
+			// A doubled quote stands for the quote character itself.
+			if b.Literal(q + q) {
+				s.WriteString(q)
+				continue
+			}
 			break
 		}
 		c := b.Get()
 		s.WriteString(c)
 	}
 	if !b.Literal(q) {
-		return s.String(), fmt.Errorf("'%s' expected", q)
+		return s.String(), fmt.Errorf("unterminated quote, %s expected", q)
 	}
 	return s.String(), nil
 }
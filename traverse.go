@@ -9,7 +9,7 @@ import (
 // inside of it.
 func traverse(x any, f func(any) error) error {
 	switch v := x.(type) {
-	case *Value, *columnRef:
+	case *Value, *columnRef, *placeholder:
 		return f(v)
 	case *functionkek:
 		if err := f(v); err != nil {
@@ -32,6 +32,17 @@ func traverse(x any, f func(any) error) error {
 			return err
 		}
 		return nil
+	case *fbinaryAnd:
+		if err := f(v); err != nil {
+			return err
+		}
+		if err := traverse(v.left, f); err != nil {
+			return err
+		}
+		if err := traverse(v.right, f); err != nil {
+			return err
+		}
+		return nil
 	case *binaryOperatorNode:
 		if err := f(v); err != nil {
 			return err
@@ -47,6 +58,11 @@ func traverse(x any, f func(any) error) error {
 		if err := f(v.From); err != nil {
 			return err
 		}
+		if sub, ok := v.From.(*Query); ok {
+			if err := traverse(sub, f); err != nil {
+				return err
+			}
+		}
 		for _, sel := range v.Selectors {
 			e1, ok := sel.Expr.(expression)
 			if !ok {
@@ -80,12 +96,17 @@ func traverse(x any, f func(any) error) error {
 			}
 		}
 		return nil
+	case *as:
+		if err := f(v); err != nil {
+			return err
+		}
+		return traverse(v.Expr, f)
 	case *star:
 		return nil
 	case *aggregate:
-		// if err := f(v); err != nil {
-		// 	return err
-		// }
+		if err := f(v); err != nil {
+			return err
+		}
 		for _, arg := range v.Args {
 			if err := traverse(arg, f); err != nil {
 				return err
@@ -93,6 +114,116 @@ func traverse(x any, f func(any) error) error {
 		}
 		return nil
 	default:
-		panic(fmt.Errorf("don't know how to traverse %s", reflect.TypeOf(x)))
+		return fmt.Errorf("don't know how to traverse %s", reflect.TypeOf(x))
+	}
+}
+
+// transform returns a copy of the expression x where every node is replaced
+// with the result of f. Children are transformed before their parents.
+func transform(x expression, f func(expression) (expression, error)) (expression, error) {
+	if x == nil {
+		return nil, nil
+	}
+	args := func(xs []expression) ([]expression, error) {
+		r := make([]expression, len(xs))
+		for i, a := range xs {
+			t, err := transform(a, f)
+			if err != nil {
+				return nil, err
+			}
+			r[i] = t
+		}
+		return r, nil
+	}
+	switch v := x.(type) {
+	case *Value, *columnRef, *placeholder, *star:
+		return f(v)
+	case *functionkek:
+		a, err := args(v.Args)
+		if err != nil {
+			return nil, err
+		}
+		return f(&functionkek{v.Name, a})
+	case *aggregate:
+		a, err := args(v.Args)
+		if err != nil {
+			return nil, err
+		}
+		return f(&aggregate{v.Name, a})
+	case *as:
+		e, err := transform(v.Expr, f)
+		if err != nil {
+			return nil, err
+		}
+		return f(&as{e, v.TypeID})
+	case *fbinaryOr:
+		a, err := args([]expression{v.left, v.right})
+		if err != nil {
+			return nil, err
+		}
+		return f(&fbinaryOr{a[0], a[1]})
+	case *fbinaryAnd:
+		a, err := args([]expression{v.left, v.right})
+		if err != nil {
+			return nil, err
+		}
+		return f(&fbinaryAnd{a[0], a[1]})
+	case *binaryOperatorNode:
+		a, err := args([]expression{v.left, v.right})
+		if err != nil {
+			return nil, err
+		}
+		return f(&binaryOperatorNode{v.op, a[0], a[1]})
+	default:
+		return nil, fmt.Errorf("don't know how to transform %s", reflect.TypeOf(x))
+	}
+}
+
+// transformQuery applies transform to all expressions in the query,
+// including subqueries, and returns the resulting copy.
+func transformQuery(q Query, f func(expression) (expression, error)) (Query, error) {
+	var err error
+	r := q
+	if sub, ok := q.From.(*Query); ok {
+		t, err := transformQuery(*sub, f)
+		if err != nil {
+			return r, err
+		}
+		r.From = &t
+	}
+	r.Selectors = make([]selector, len(q.Selectors))
+	for i, s := range q.Selectors {
+		r.Selectors[i].Alias = s.Alias
+		if r.Selectors[i].Expr, err = transform(s.Expr, f); err != nil {
+			return r, err
+		}
+	}
+	r.Joins = nil
+	for _, j := range q.Joins {
+		c, err := transform(j.Condition, f)
+		if err != nil {
+			return r, err
+		}
+		r.Joins = append(r.Joins, joinspec{j.Table, c})
+	}
+	if r.Filter, err = transform(q.Filter, f); err != nil {
+		return r, err
+	}
+	r.GroupBy = nil
+	for _, g := range q.GroupBy {
+		t, err := transform(g, f)
+		if err != nil {
+			return r, err
+		}
+		r.GroupBy = append(r.GroupBy, t)
+	}
+	r.OrderBy = nil
+	for _, o := range q.OrderBy {
+		t, err := transform(o.expr, f)
+		if err != nil {
+			return r, err
+		}
+		r.OrderBy = append(r.OrderBy, orderspec{o.desc, t})
 	}
+	return r, nil
 }
@@ -0,0 +1,106 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Signature describes the argument and result types of a function.
+// An Any argument accepts values of any type. If Variadic is set, the last
+// argument type may be repeated any number of times, including zero.
+type Signature struct {
+	Args     []ValueTypeID
+	Variadic bool
+	Result   ValueTypeID
+}
+
+type scalarFunction struct {
+	name string
+	sig  Signature
+	fn   func(args []Value) (Value, error)
+}
+
+// RegisterFunction adds a scalar function to the engine. Function names are
+// case-insensitive. A registered function shadows built-in functions and
+// aggregates with the same name.
+func (e Engine) RegisterFunction(name string, sig Signature, fn func(args []Value) (Value, error)) error {
+	n, err := functionName(name)
+	if err != nil {
+		return err
+	}
+	if _, ok := e.aggregates[n]; ok {
+		return fmt.Errorf("%s is already registered as an aggregate", name)
+	}
+	if sig.Variadic && len(sig.Args) == 0 {
+		return fmt.Errorf("variadic function %s must declare at least one argument type", name)
+	}
+	e.functions[n] = &scalarFunction{name, sig, fn}
+	return nil
+}
+
+// RegisterAggregate adds an aggregate function to the engine. The factory is
+// called to create a new accumulator for every group.
+func (e Engine) RegisterAggregate(name string, factory func() Accumulator) error {
+	n, err := functionName(name)
+	if err != nil {
+		return err
+	}
+	if _, ok := e.functions[n]; ok {
+		return fmt.Errorf("%s is already registered as a function", name)
+	}
+	e.aggregates[n] = factory
+	return nil
+}
+
+func functionName(name string) (string, error) {
+	n := strings.ToLower(name)
+	if n == "" || n == "cast" {
+		return "", fmt.Errorf("invalid function name: %q", name)
+	}
+	for _, k := range keywords {
+		if n == k {
+			return "", fmt.Errorf("function name is a keyword: %s", name)
+		}
+	}
+	for _, c := range n {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+			return "", fmt.Errorf("invalid function name: %q", name)
+		}
+	}
+	return n, nil
+}
+
+// checkArgs checks the argument types against the signature.
+// Undefined types are unknown before execution and are not checked.
+func (f *scalarFunction) checkArgs(types []ValueTypeID) error {
+	n := len(f.sig.Args)
+	if f.sig.Variadic {
+		if len(types) < n-1 {
+			return fmt.Errorf("the %s function expects at least %d arguments, got %d", strings.ToUpper(f.name), n-1, len(types))
+		}
+	} else if len(types) != n {
+		return fmt.Errorf("the %s function expects %d arguments, got %d", strings.ToUpper(f.name), n, len(types))
+	}
+	for i, t := range types {
+		want := f.sig.Args[n-1]
+		if i < n {
+			want = f.sig.Args[i]
+		}
+		if want == Any || t == undefined || t == want {
+			continue
+		}
+		return fmt.Errorf("the %s function expects argument %d to be %s, got %s", strings.ToUpper(f.name), i+1, getTypeName(want), getTypeName(t))
+	}
+	return nil
+}
+
+func (f *scalarFunction) call(args []Value) (Value, error) {
+	types := make([]ValueTypeID, len(args))
+	for i, a := range args {
+		types[i] = a.Type
+	}
+	if err := f.checkArgs(types); err != nil {
+		return Value{}, err
+	}
+	return f.fn(args)
+}
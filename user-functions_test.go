@@ -0,0 +1,95 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type sumAccumulator struct {
+	sum int
+}
+
+func (a *sumAccumulator) Step(args []Value) error {
+	if args[0].Data != nil {
+		a.sum += args[0].Data.(int)
+	}
+	return nil
+}
+
+func (a *sumAccumulator) Merge(other Accumulator) error {
+	a.sum += other.(*sumAccumulator).sum
+	return nil
+}
+
+func (a *sumAccumulator) Final() (Value, error) {
+	return Value{Int, a.sum}, nil
+}
+
+func TestUserFunctions(t *testing.T) {
+	engine := New(map[string]Table{
+		"t": dummy{
+			{"x": Value{Int, 1}, "g": Value{String, "a"}},
+			{"x": Value{Int, 2}, "g": Value{String, "a"}},
+			{"x": Value{Int, 3}, "g": Value{String, "b"}},
+		},
+		"empty": dummy{},
+	})
+	double := func(args []Value) (Value, error) {
+		return Value{Int, args[0].Data.(int) * 2}, nil
+	}
+	if err := engine.RegisterFunction("Double_It", Signature{Args: []ValueTypeID{Int}, Result: Int}, double); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.RegisterFunction("min", Signature{Args: []ValueTypeID{Int, Int}, Result: Int}, func(args []Value) (Value, error) {
+		if args[1].Data.(int) < args[0].Data.(int) {
+			return args[1], nil
+		}
+		return args[0], nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.RegisterAggregate("SUM", func() Accumulator { return &sumAccumulator{} }); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		query string
+		want  []map[string]any
+	}{
+		{`select double_it(x) as d from t`, []map[string]any{{"d": 2}, {"d": 4}, {"d": 6}}},
+		{`select min(x, 2) as m from t`, []map[string]any{{"m": 1}, {"m": 2}, {"m": 2}}},
+		{`select g, sum(x) as s from t group by g`, []map[string]any{{`"g"`: "a", "s": 3}, {`"g"`: "b", "s": 3}}},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			r, err := engine.ExecString(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(rowsAsJSON(r), c.want); diff != "" {
+				t.Fatalf("%s", diff)
+			}
+		})
+	}
+
+	errors := []struct {
+		query string
+		err   string
+	}{
+		{`select double_it(x, x) from t`, "the DOUBLE_IT function expects 1 arguments, got 2"},
+		{`select double_it('a') from t`, "the DOUBLE_IT function expects argument 1 to be Int, got String"},
+		{`select avg(x) from t`, "unknown function avg"},
+	}
+	for _, c := range errors {
+		t.Run(c.query, func(t *testing.T) {
+			_, err := engine.ExecString(c.query)
+			if err == nil {
+				t.Fatalf("expected an error, got nil")
+			}
+			if diff := cmp.Diff(c.err, err.Error()); diff != "" {
+				t.Fatalf("%s", diff)
+			}
+		})
+	}
+}
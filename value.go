@@ -2,6 +2,8 @@ package sql
 
 import (
 	"fmt"
+	"math"
+	"reflect"
 	"strconv"
 	"strings"
 )
@@ -18,6 +20,9 @@ const (
 	JSON
 )
 
+// Any is a placeholder type that matches values of all types.
+const Any = undefined
+
 type Value struct {
 	Type ValueTypeID
 	Data any
@@ -25,8 +30,18 @@ type Value struct {
 
 func getTypeID(s string) ValueTypeID {
 	switch strings.ToLower(s) {
+	case "string":
+		return String
 	case "int":
 		return Int
+	case "double":
+		return Double
+	case "bool":
+		return Bool
+	case "array":
+		return Array
+	case "json":
+		return JSON
 	}
 	return undefined
 }
@@ -45,8 +60,10 @@ func getTypeName(t ValueTypeID) string {
 		return "Array"
 	case JSON:
 		return "JSON"
+	case undefined:
+		return "Any"
 	default:
-		panic(fmt.Errorf("unexpected value type: %d", t))
+		return fmt.Sprintf("Type(%d)", t)
 	}
 }
 
@@ -54,54 +71,70 @@ func (e Value) String() string {
 	return fmt.Sprintf("%v", e.Data)
 }
 
+// eq tells whether the values are equal. A NULL is not equal to anything.
 func (a Value) eq(b Value) (bool, error) {
+	if a.Data == nil || b.Data == nil {
+		return false, nil
+	}
 	if a.Type == Double && b.Type == Int {
 		return a.Data.(float64) == float64(b.Data.(int)), nil
 	}
+	if a.Type == Int && b.Type == Double {
+		return float64(a.Data.(int)) == b.Data.(float64), nil
+	}
 	if a.Type != b.Type {
 		return false, fmt.Errorf("can't compare values of different types: %s and %s", getTypeName(a.Type), getTypeName(b.Type))
 	}
 	switch a.Type {
-	case String, Int:
+	case String, Int, Double, Bool:
 		return a.Data == b.Data, nil
 	default:
 		return false, fmt.Errorf("eq: don't know how to compare values of type %s", getTypeName(a.Type))
 	}
 }
 
+// lessThan tells whether a goes before b. Comparisons with NULL are false.
 func (a Value) lessThan(b Value) (bool, error) {
+	if a.Data == nil || b.Data == nil {
+		return false, nil
+	}
 	if a.Type == Double && b.Type == Int {
 		return a.Data.(float64) < float64(b.Data.(int)), nil
 	}
+	if a.Type == Int && b.Type == Double {
+		return float64(a.Data.(int)) < b.Data.(float64), nil
+	}
 	if a.Type != b.Type {
 		return false, fmt.Errorf("can't compare values of different types: %s and %s", getTypeName(a.Type), getTypeName(b.Type))
 	}
-	if a.Data == nil || b.Data == nil {
-		return false, nil
-	}
 	switch a.Type {
 	case Int:
 		return a.Data.(int) < b.Data.(int), nil
 	case Double:
 		return a.Data.(float64) < b.Data.(float64), nil
+	case String:
+		return a.Data.(string) < b.Data.(string), nil
+	case Bool:
+		return !a.Data.(bool) && b.Data.(bool), nil
 	default:
 		return false, fmt.Errorf("lessThan: don't know how to compare values of type %s", getTypeName(a.Type))
 	}
 }
 
 func (a Value) greaterThan(b Value) (bool, error) {
-	eq, err := a.eq(b)
-	if err != nil || eq {
-		return false, err
-	}
-	lt, err := a.lessThan(b)
-	return !lt, err
+	return b.lessThan(a)
 }
 
 func (a Value) cast(typeID ValueTypeID) (Value, error) {
 	if typeID == a.Type {
 		return a, nil
 	}
+	if a.Data == nil {
+		return Value{typeID, nil}, nil
+	}
+	if typeID == JSON {
+		return Value{JSON, a.Data}, nil
+	}
 	switch a.Type {
 	case String:
 		switch typeID {
@@ -111,7 +144,87 @@ func (a Value) cast(typeID ValueTypeID) (Value, error) {
 				return Value{}, err
 			}
 			return Value{Int, i}, nil
+		case Double:
+			f, err := strconv.ParseFloat(a.Data.(string), 64)
+			if err != nil {
+				return Value{}, err
+			}
+			return Value{Double, f}, nil
+		case Bool:
+			b, err := strconv.ParseBool(a.Data.(string))
+			if err != nil {
+				return Value{}, err
+			}
+			return Value{Bool, b}, nil
+		}
+	case Int:
+		switch typeID {
+		case String:
+			return Value{String, strconv.Itoa(a.Data.(int))}, nil
+		case Double:
+			return Value{Double, float64(a.Data.(int))}, nil
+		}
+	case Double:
+		switch typeID {
+		case String:
+			return Value{String, strconv.FormatFloat(a.Data.(float64), 'g', -1, 64)}, nil
+		case Int:
+			f := a.Data.(float64)
+			if float64(int(f)) != f {
+				return Value{}, fmt.Errorf("%v is not an integer", f)
+			}
+			return Value{Int, int(f)}, nil
+		}
+	case Bool:
+		if typeID == String {
+			return Value{String, strconv.FormatBool(a.Data.(bool))}, nil
 		}
 	}
 	return Value{}, fmt.Errorf("conversion from %s to %s not implemented", getTypeName(a.Type), getTypeName(typeID))
 }
+
+// valueOf converts a Go value to a Value.
+func valueOf(x any) (Value, error) {
+	switch v := x.(type) {
+	case nil:
+		return Value{Any, nil}, nil
+	case Value:
+		return v, nil
+	}
+	r := reflect.ValueOf(x)
+	switch r.Kind() {
+	case reflect.String:
+		return Value{String, r.String()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Value{Int, int(r.Int())}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if r.Uint() > math.MaxInt {
+			return Value{}, fmt.Errorf("%d overflows Int", r.Uint())
+		}
+		return Value{Int, int(r.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return Value{Double, r.Float()}, nil
+	case reflect.Bool:
+		return Value{Bool, r.Bool()}, nil
+	case reflect.Slice, reflect.Array:
+		// Bytes are text, as in database/sql.
+		if r.Kind() == reflect.Slice && r.Type().Elem().Kind() == reflect.Uint8 {
+			return Value{String, string(r.Bytes())}, nil
+		}
+		items := make([]Value, r.Len())
+		for i := range items {
+			item, err := valueOf(r.Index(i).Interface())
+			if err != nil {
+				return Value{}, err
+			}
+			items[i] = item
+		}
+		return Value{Array, items}, nil
+	case reflect.Pointer:
+		if r.IsNil() {
+			return Value{Any, nil}, nil
+		}
+		return valueOf(r.Elem().Interface())
+	}
+	return Value{}, fmt.Errorf("unsupported parameter type: %s", reflect.TypeOf(x))
+}